@@ -0,0 +1,166 @@
+package monibot
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// A MachineSampler produces machine samples.
+// See package github.com/cvilsmeier/monibot-go/machine for
+// a sampler that reads the Linux proc filesystem.
+type MachineSampler interface {
+	Sample() (MachineSample, error)
+}
+
+// MachineAgentOptions holds optional parameters for RunMachineAgentWithOptions.
+type MachineAgentOptions struct {
+
+	// Default is no logging.
+	Logger Logger
+
+	// The interval in which samples are taken and posted.
+	// Default is 1m.
+	Interval time.Duration
+
+	// Text, if not nil, produces a machine text that is posted
+	// every TextInterval, e.g. the output of 'df -h' or 'top -bn1'.
+	Text func(ctx context.Context) (string, error)
+
+	// The interval in which texts are posted.
+	// Default is 1h.
+	TextInterval time.Duration
+
+	// The maximum number of samples that are held while earlier
+	// samples are still being posted. If more samples are pending,
+	// the oldest ones are discarded. Texts are not counted, but a
+	// pending text is replaced by a newer one.
+	// Default is 10.
+	MaxPending int
+}
+
+// RunMachineAgent is like RunMachineAgentWithOptions with
+// default options and the given sampling interval.
+func RunMachineAgent(ctx context.Context, api Client, machineId string, interval time.Duration, sampler MachineSampler) error {
+	return RunMachineAgentWithOptions(ctx, api, machineId, sampler, MachineAgentOptions{Interval: interval})
+}
+
+// RunMachineAgentWithOptions takes a machine sample every interval and
+// posts it with PostMachineSample. It blocks until ctx is done and
+// returns ctx.Err(), so it is usually started in its own goroutine.
+//
+// Sampling is never delayed by posting: if a post takes longer than
+// the interval (e.g. because the API is retrying), new samples are
+// queued and posted one after another, never concurrently. Samples
+// that cannot be posted are logged and discarded.
+//
+// One sample is taken at startup and discarded, so that samplers that
+// compute values since the last sample start with a full interval.
+func RunMachineAgentWithOptions(ctx context.Context, api Client, machineId string, sampler MachineSampler, options MachineAgentOptions) error {
+	ticker := time.NewTicker(cmp.Or(options.Interval, time.Minute))
+	defer ticker.Stop()
+	var textTicks <-chan time.Time
+	if options.Text != nil {
+		textTicker := time.NewTicker(cmp.Or(options.TextInterval, time.Hour))
+		defer textTicker.Stop()
+		textTicks = textTicker.C
+	}
+	return runMachineAgent(ctx, api, machineId, sampler, options, ticker.C, textTicks)
+}
+
+// machinePost is a pending sample or text post.
+type machinePost struct {
+	sample *MachineSample
+	text   string
+}
+
+func runMachineAgent(ctx context.Context, api Client, machineId string, sampler MachineSampler, options MachineAgentOptions, ticks, textTicks <-chan time.Time) error {
+	logger := options.Logger
+	if logger == nil {
+		logger = zeroLogger{}
+	}
+	maxPending := cmp.Or(options.MaxPending, 10)
+	if _, err := sampler.Sample(); err != nil {
+		logger.Debug("cannot take initial sample: %s", err)
+	}
+	var pending []machinePost
+	var posting chan struct{} // non-nil while a post goroutine is running
+	startPosting := func() {
+		if posting != nil || len(pending) == 0 {
+			return
+		}
+		posts := pending
+		pending = nil
+		posting = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			for _, p := range posts {
+				if p.sample != nil {
+					if err := api.PostMachineSampleWithContext(ctx, machineId, *p.sample); err != nil {
+						logger.Debug("cannot post machine sample: %s", err)
+					}
+				} else {
+					if err := api.PostMachineTextWithContext(ctx, machineId, p.text); err != nil {
+						logger.Debug("cannot post machine text: %s", err)
+					}
+				}
+			}
+		}(posting)
+	}
+	for {
+		select {
+		case <-ticks:
+			sample, err := sampler.Sample()
+			if err != nil {
+				logger.Debug("cannot take sample: %s", err)
+				continue
+			}
+			pending = append(pending, machinePost{sample: &sample})
+			if n := countSamples(pending); n > maxPending {
+				logger.Debug("discarding %d pending samples", n-maxPending)
+				pending = discardSamples(pending, n-maxPending)
+			}
+			startPosting()
+		case <-textTicks:
+			text, err := options.Text(ctx)
+			if err != nil {
+				logger.Debug("cannot create machine text: %s", err)
+				continue
+			}
+			pending = slices.DeleteFunc(pending, func(p machinePost) bool { return p.sample == nil })
+			pending = append(pending, machinePost{text: text})
+			startPosting()
+		case <-posting:
+			posting = nil
+			startPosting()
+		case <-ctx.Done():
+			if posting != nil {
+				<-posting
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// countSamples returns the number of sample posts.
+func countSamples(posts []machinePost) int {
+	n := 0
+	for _, p := range posts {
+		if p.sample != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// discardSamples removes the n oldest sample posts, texts are kept.
+func discardSamples(posts []machinePost, n int) []machinePost {
+	return slices.DeleteFunc(posts, func(p machinePost) bool {
+		if p.sample == nil || n == 0 {
+			return false
+		}
+		n--
+		return true
+	})
+}
@@ -0,0 +1,102 @@
+package monibot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestMachineAgent(t *testing.T) {
+	is := assert.New(t)
+	sender := &chanSender{make(chan string), make(chan error)}
+	api := &Api{sender}
+	sampler := &fakeSampler{failAt: 6}
+	ticks := make(chan time.Time)
+	textTicks := make(chan time.Time)
+	texts := 0
+	options := MachineAgentOptions{
+		MaxPending: 2,
+		Text: func(ctx context.Context) (string, error) {
+			texts++
+			return fmt.Sprintf("hello%d", texts), nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- runMachineAgent(ctx, api, "m1", sampler, options, ticks, textTicks)
+	}()
+	// first tick posts second sample, first sample was discarded at startup
+	ticks <- time.Now()
+	is.Eq("POST machine/m1/sample tstamp=2", cutSampleCall(<-sender.calls))
+	// sampling continues while post is in progress, oldest samples
+	// are discarded, texts are kept but replaced by newer texts
+	textTicks <- time.Now()
+	ticks <- time.Now()
+	textTicks <- time.Now()
+	ticks <- time.Now()
+	ticks <- time.Now()
+	sender.release <- errors.New("status 500")
+	is.Eq("POST machine/m1/text text=hello2", <-sender.calls)
+	sender.release <- nil
+	is.Eq("POST machine/m1/sample tstamp=4", cutSampleCall(<-sender.calls))
+	sender.release <- nil
+	is.Eq("POST machine/m1/sample tstamp=5", cutSampleCall(<-sender.calls))
+	sender.release <- nil
+	// sampler errors do not stop the agent
+	ticks <- time.Now()
+	ticks <- time.Now()
+	is.Eq("POST machine/m1/sample tstamp=7", cutSampleCall(<-sender.calls))
+	// cancel stops the agent after the post in progress returned
+	cancel()
+	is.Eq(context.Canceled, <-result)
+	is.Eq(7, sampler.n)
+}
+
+// cutSampleCall cuts a machine sample post call after the tstamp parameter.
+func cutSampleCall(call string) string {
+	call, _, _ = strings.Cut(call, "&")
+	return call
+}
+
+// fakeSampler is a MachineSampler for unit tests
+type fakeSampler struct {
+	n      int
+	failAt int
+}
+
+func (f *fakeSampler) Sample() (MachineSample, error) {
+	f.n++
+	if f.n == f.failAt {
+		return MachineSample{}, fmt.Errorf("cannot read /proc/stat")
+	}
+	return MachineSample{Tstamp: int64(f.n)}, nil
+}
+
+// chanSender is a apiSender that is safe for concurrent use in unit tests.
+// It sends each call to the calls channel, and then waits for
+// a result on the release channel.
+type chanSender struct {
+	calls   chan string
+	release chan error
+}
+
+func (f *chanSender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	call := strings.TrimSpace(method + " " + path + " " + string(body))
+	select {
+	case f.calls <- call:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case err := <-f.release:
+		return nil, err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", call, ctx.Err())
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,7 +19,8 @@ import (
 // ApiOptions holds optional parameters for a Api.
 type ApiOptions struct {
 
-	// Default is no logging. If you want debug logging: Bring your own logger.
+	// Default is no logging. If you want debug logging: Bring your own logger,
+	// or use NewSlogLogger for structured logging.
 	Logger Logger
 
 	// MonibotUrl is the base url to send api calls to.
@@ -28,20 +32,81 @@ type ApiOptions struct {
 	// Default is 12 trials.
 	Trials int
 
-	// The time to wait between trials.
+	// The time to wait between trials. It is ignored if RetryPolicy is set.
 	// Default is 5s delay between trials.
 	Delay time.Duration
 
+	// RetryPolicy computes the time to wait between trials. If the API
+	// sends a Retry-After or X-RateLimit-Reset header that asks for a
+	// longer delay, the longer delay is used, but at most 5m.
+	// Default is ConstantRetryPolicy(Delay).
+	RetryPolicy RetryPolicy
+
+	// The maximum total time to spend on one API call, including all
+	// trials and delays. No trial is started if it would exceed it.
+	// Default is 0, which means no limit.
+	MaxElapsed time.Duration
+
 	// The "User-Agent" header value. The placeholder $sdkVersion, if present,
 	// is substituted by the monibot-go sdk version.
 	// Default is "$sdkVersion".
 	UserAgent string
 
+	// HttpClient is the client used for sending requests. Use it
+	// for proxies, custom TLS roots or connection-pool limits.
+	// If set, ConnectTimeout and ResponseHeaderTimeout are ignored.
+	// Default is a client with ConnectTimeout and ResponseHeaderTimeout.
+	HttpClient *http.Client
+
+	// The maximum time to wait for a connection to be established.
+	// Default is 10s.
+	ConnectTimeout time.Duration
+
+	// The maximum time to wait for response headers after the request
+	// has been written.
+	// Default is 30s.
+	ResponseHeaderTimeout time.Duration
+
+	// The maximum time a single request (one trial) may take,
+	// including reading the response body.
+	// Default is 60s.
+	Timeout time.Duration
+
+	// Interceptors wrap each trial of each API call, the first
+	// interceptor being the outermost one. Use them for tracing,
+	// self-metrics, request signing or audit logging.
+	// Default is no interceptors.
+	Interceptors []Interceptor
+
+	// The maximum number of requests (trials) per second that are sent
+	// by this Api, shared by all goroutines that use it. If the API
+	// responds with status 429, the rate is halved, and it recovers
+	// slowly with each successful request.
+	// Default is 0, which means no limit.
+	RateLimit float64
+
+	// The number of requests that may be sent at once before RateLimit
+	// applies. It is ignored if RateLimit is 0.
+	// Default is 1.
+	RateBurst int
+
+	// CircuitBreaker, if not nil, makes API calls fail fast while
+	// the API is down. See NewCircuitBreaker.
+	// Default is no circuit breaker.
+	CircuitBreaker *CircuitBreaker
+
+	// Spool, if not nil, stores machine and metric posts that cannot be
+	// sent, and replays them later in the background. See OpenSpool.
+	// Default is no spool.
+	Spool *Spool
+
 	// Default is time.After (this is only used in tests and therefore not exported).
 	timeAfter sending.TimeAfterFunc
 }
 
 // An apiSender provides a Send method and can be overridden in unit tests.
+// Send must not retain body after it returned, because the caller may
+// reuse it.
 type apiSender interface {
 	Send(ctx context.Context, method, path string, body []byte) ([]byte, error)
 }
@@ -68,15 +133,39 @@ func NewApiWithOptions(apiKey string, options ApiOptions) *Api {
 	}
 	monibotUrl := cmp.Or(options.MonibotUrl, "http://monibot.io")
 	trials := cmp.Or(options.Trials, 12)
-	delay := cmp.Or(options.Delay, 5*time.Second)
+	retryPolicy := options.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = ConstantRetryPolicy(cmp.Or(options.Delay, 5*time.Second))
+	}
 	timeAfter := options.timeAfter
 	if timeAfter == nil {
 		timeAfter = time.After
 	}
 	userAgent := cmp.Or(options.UserAgent, "$sdkVersion")
 	userAgent = strings.ReplaceAll(userAgent, "$sdkVersion", "monibot-go/"+Version)
-	transport := sending.NewTransport(logger, monibotUrl, apiKey, userAgent)
-	sender := sending.NewSender(transport, logger, trials, delay, timeAfter)
+	httpClient := options.HttpClient
+	if httpClient == nil {
+		connectTimeout := cmp.Or(options.ConnectTimeout, 10*time.Second)
+		responseHeaderTimeout := cmp.Or(options.ResponseHeaderTimeout, 30*time.Second)
+		httpClient = sending.NewHttpClient(connectTimeout, responseHeaderTimeout)
+	}
+	timeout := cmp.Or(options.Timeout, 60*time.Second)
+	sendLogger, ok := logger.(sending.Logger)
+	if !ok {
+		sendLogger = sending.DebugLogger(logger)
+	}
+	transport := sending.NewTransport(sendLogger, httpClient, timeout, monibotUrl, apiKey, userAgent)
+	interceptors := options.Interceptors
+	if options.RateLimit > 0 {
+		limiter := sending.NewLimiter(options.RateLimit, options.RateBurst, time.Now, timeAfter)
+		interceptors = append(slices.Clip(interceptors), limiter.Intercept)
+	}
+	var sender apiSender = sending.NewSender(transport, sendLogger, trials, retryPolicy, options.MaxElapsed, interceptors, options.CircuitBreaker, timeAfter)
+	if options.Spool != nil {
+		replaySender := sending.NewSender(transport, sendLogger, 1, retryPolicy, 0, interceptors, options.CircuitBreaker, timeAfter)
+		options.Spool.start(replaySender, logger)
+		sender = &spoolSender{sender, options.Spool, logger}
+	}
 	return &Api{sender}
 }
 
@@ -126,6 +215,59 @@ func (a *Api) GetWatchdogWithContext(ctx context.Context, watchdogId string) (Wa
 	return w, err
 }
 
+// CreateWatchdog is like CreateWatchdogWithContext using context.Background.
+func (a *Api) CreateWatchdog(name string, interval time.Duration) (Watchdog, error) {
+	return a.CreateWatchdogWithContext(context.Background(), name, interval)
+}
+
+// CreateWatchdogWithContext creates a watchdog that expects a
+// heartbeat every interval, and returns it with its new id.
+// The request is not idempotent and is tried only once.
+func (a *Api) CreateWatchdogWithContext(ctx context.Context, name string, interval time.Duration) (Watchdog, error) {
+	body, err := watchdogBody(name, interval)
+	if err != nil {
+		return Watchdog{}, err
+	}
+	return sendAndDecode[Watchdog](sending.WithSingleTrial(ctx), a, "POST", "watchdogs", body)
+}
+
+// UpdateWatchdog is like UpdateWatchdogWithContext using context.Background.
+func (a *Api) UpdateWatchdog(watchdogId string, name string, interval time.Duration) (Watchdog, error) {
+	return a.UpdateWatchdogWithContext(context.Background(), watchdogId, name, interval)
+}
+
+// UpdateWatchdogWithContext changes the name and interval of a
+// watchdog, and returns the updated watchdog.
+func (a *Api) UpdateWatchdogWithContext(ctx context.Context, watchdogId string, name string, interval time.Duration) (Watchdog, error) {
+	body, err := watchdogBody(name, interval)
+	if err != nil {
+		return Watchdog{}, err
+	}
+	return sendAndDecode[Watchdog](ctx, a, "PUT", "watchdog/"+watchdogId, body)
+}
+
+// DeleteWatchdog is like DeleteWatchdogWithContext using context.Background.
+func (a *Api) DeleteWatchdog(watchdogId string) error {
+	return a.DeleteWatchdogWithContext(context.Background(), watchdogId)
+}
+
+// DeleteWatchdogWithContext deletes a watchdog.
+func (a *Api) DeleteWatchdogWithContext(ctx context.Context, watchdogId string) error {
+	_, err := a.sender.Send(ctx, "DELETE", "watchdog/"+watchdogId, nil)
+	return err
+}
+
+func watchdogBody(name string, interval time.Duration) ([]byte, error) {
+	if name == "" {
+		return nil, fmt.Errorf("cannot send empty name")
+	}
+	if interval < time.Millisecond {
+		return nil, fmt.Errorf("cannot send interval %s", interval)
+	}
+	values := url.Values{"name": {name}, "intervalMillis": {strconv.FormatInt(interval.Milliseconds(), 10)}}
+	return []byte(values.Encode()), nil
+}
+
 // PostWatchdogHeartbeat is like PostWatchdogHeartbeatWithContext using context.Background.
 func (a *Api) PostWatchdogHeartbeat(watchdogId string) error {
 	return a.PostWatchdogHeartbeatWithContext(context.Background(), watchdogId)
@@ -169,6 +311,47 @@ func (a *Api) GetMachineWithContext(ctx context.Context, machineId string) (Mach
 	return machine, err
 }
 
+// CreateMachine is like CreateMachineWithContext using context.Background.
+func (a *Api) CreateMachine(name string) (Machine, error) {
+	return a.CreateMachineWithContext(context.Background(), name)
+}
+
+// CreateMachineWithContext creates a machine and returns it with its new id.
+// The request is not idempotent and is tried only once.
+func (a *Api) CreateMachineWithContext(ctx context.Context, name string) (Machine, error) {
+	body, err := nameBody(name)
+	if err != nil {
+		return Machine{}, err
+	}
+	return sendAndDecode[Machine](sending.WithSingleTrial(ctx), a, "POST", "machines", body)
+}
+
+// UpdateMachine is like UpdateMachineWithContext using context.Background.
+func (a *Api) UpdateMachine(machineId string, name string) (Machine, error) {
+	return a.UpdateMachineWithContext(context.Background(), machineId, name)
+}
+
+// UpdateMachineWithContext changes the name of a machine,
+// and returns the updated machine.
+func (a *Api) UpdateMachineWithContext(ctx context.Context, machineId string, name string) (Machine, error) {
+	body, err := nameBody(name)
+	if err != nil {
+		return Machine{}, err
+	}
+	return sendAndDecode[Machine](ctx, a, "PUT", "machine/"+machineId, body)
+}
+
+// DeleteMachine is like DeleteMachineWithContext using context.Background.
+func (a *Api) DeleteMachine(machineId string) error {
+	return a.DeleteMachineWithContext(context.Background(), machineId)
+}
+
+// DeleteMachineWithContext deletes a machine.
+func (a *Api) DeleteMachineWithContext(ctx context.Context, machineId string) error {
+	_, err := a.sender.Send(ctx, "DELETE", "machine/"+machineId, nil)
+	return err
+}
+
 // PostMachineSample is like PostMachineSampleWithContext using context.Background.
 func (a *Api) PostMachineSample(machineId string, sample MachineSample) error {
 	return a.PostMachineSampleWithContext(context.Background(), machineId, sample)
@@ -176,54 +359,13 @@ func (a *Api) PostMachineSample(machineId string, sample MachineSample) error {
 
 // PostMachineSampleWithContext uploads a machine sample to the API.
 func (a *Api) PostMachineSampleWithContext(ctx context.Context, machineId string, sample MachineSample) error {
-	toks := make([]string, 0, 15+len(sample.Disks)*10) // 15 for machine, 10 for each disk sample
-	toks = append(toks,
-		fmt.Sprintf("tstamp=%d", sample.Tstamp),
-		fmt.Sprintf("load1=%.3f", sample.Load1),
-		fmt.Sprintf("load5=%.3f", sample.Load5),
-		fmt.Sprintf("load15=%.3f", sample.Load15),
-		fmt.Sprintf("cpu=%d", sample.CpuPercent),
-		fmt.Sprintf("mem=%d", sample.MemPercent),
-	)
-	if len(sample.Disks) > 0 {
-		toks = append(toks,
-			fmt.Sprintf("disks=%d", len(sample.Disks)), // number of disks, default is 0
-		)
-		for i, disk := range sample.Disks {
-			toks = append(toks,
-				fmt.Sprintf("disks[%d].device=%s", i, url.QueryEscape(disk.Device)),
-				fmt.Sprintf("disks[%d].mountpoint=%s", i, url.QueryEscape(disk.Mountpoint)),
-				fmt.Sprintf("disks[%d].total=%d", i, disk.Total),
-				fmt.Sprintf("disks[%d].used=%d", i, disk.Used),
-				fmt.Sprintf("disks[%d].usedPercent=%d", i, disk.UsedPercent),
-				fmt.Sprintf("disks[%d].readBytes=%d", i, disk.ReadBytes),
-				fmt.Sprintf("disks[%d].writeBytes=%d", i, disk.WriteBytes),
-			)
-		}
-	}
-	toks = append(toks,
-		fmt.Sprintf("disk=%d", sample.DiskPercent),
-		fmt.Sprintf("diskRead=%d", sample.DiskRead),
-		fmt.Sprintf("diskWrite=%d", sample.DiskWrite),
-	)
-	if len(sample.Nets) > 0 {
-		toks = append(toks,
-			fmt.Sprintf("nets=%d", len(sample.Nets)), // number of nets, default is 0
-		)
-		for i, net := range sample.Nets {
-			toks = append(toks,
-				fmt.Sprintf("nets[%d].device=%s", i, url.QueryEscape(net.Device)),
-				fmt.Sprintf("nets[%d].recvBytes=%d", i, net.RecvBytes),
-				fmt.Sprintf("nets[%d].sendBytes=%d", i, net.SendBytes),
-			)
-		}
+	buf := sampleBuffers.Get().(*[]byte)
+	body := EncodeMachineSample((*buf)[:0], sample)
+	_, err := a.sender.Send(ctx, "POST", "machine/"+machineId+"/sample", body)
+	if cap(body) <= maxSampleBuffer {
+		*buf = body
+		sampleBuffers.Put(buf)
 	}
-	toks = append(toks,
-		fmt.Sprintf("netRecv=%d", sample.NetRecv),
-		fmt.Sprintf("netSend=%d", sample.NetSend),
-	)
-	body := strings.Join(toks, "&")
-	_, err := a.sender.Send(ctx, "POST", "machine/"+machineId+"/sample", []byte(body))
 	return err
 }
 
@@ -271,6 +413,70 @@ func (a *Api) GetMetricWithContext(ctx context.Context, metricId string) (Metric
 	return metric, err
 }
 
+// CreateMetric is like CreateMetricWithContext using context.Background.
+func (a *Api) CreateMetric(name string, metricType int) (Metric, error) {
+	return a.CreateMetricWithContext(context.Background(), name, metricType)
+}
+
+// CreateMetricWithContext creates a metric of a type (MetricTypeCounter,
+// MetricTypeGauge or MetricTypeHistogram) and returns it with its new id.
+// The request is not idempotent and is tried only once.
+func (a *Api) CreateMetricWithContext(ctx context.Context, name string, metricType int) (Metric, error) {
+	if metricType < MetricTypeCounter || metricType > MetricTypeHistogram {
+		return Metric{}, fmt.Errorf("cannot send metric type %d", metricType)
+	}
+	body, err := nameBody(name)
+	if err != nil {
+		return Metric{}, err
+	}
+	body = fmt.Appendf(body, "&type=%d", metricType)
+	return sendAndDecode[Metric](sending.WithSingleTrial(ctx), a, "POST", "metrics", body)
+}
+
+// UpdateMetric is like UpdateMetricWithContext using context.Background.
+func (a *Api) UpdateMetric(metricId string, name string) (Metric, error) {
+	return a.UpdateMetricWithContext(context.Background(), metricId, name)
+}
+
+// UpdateMetricWithContext changes the name of a metric, and returns
+// the updated metric. The type of a metric cannot be changed.
+func (a *Api) UpdateMetricWithContext(ctx context.Context, metricId string, name string) (Metric, error) {
+	body, err := nameBody(name)
+	if err != nil {
+		return Metric{}, err
+	}
+	return sendAndDecode[Metric](ctx, a, "PUT", "metric/"+metricId, body)
+}
+
+// DeleteMetric is like DeleteMetricWithContext using context.Background.
+func (a *Api) DeleteMetric(metricId string) error {
+	return a.DeleteMetricWithContext(context.Background(), metricId)
+}
+
+// DeleteMetricWithContext deletes a metric.
+func (a *Api) DeleteMetricWithContext(ctx context.Context, metricId string) error {
+	_, err := a.sender.Send(ctx, "DELETE", "metric/"+metricId, nil)
+	return err
+}
+
+func nameBody(name string) ([]byte, error) {
+	if name == "" {
+		return nil, fmt.Errorf("cannot send empty name")
+	}
+	return []byte(url.Values{"name": {name}}.Encode()), nil
+}
+
+// sendAndDecode sends a request and decodes the JSON response.
+func sendAndDecode[T any](ctx context.Context, a *Api, method, path string, body []byte) (T, error) {
+	var v T
+	data, err := a.sender.Send(ctx, method, path, body)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
 // PostMetricInc is like PostMetricIncWithContext using context.Background.
 func (a *Api) PostMetricInc(metricId string, value int64) error {
 	if value < 0 {
@@ -287,8 +493,8 @@ func (a *Api) PostMetricIncWithContext(ctx context.Context, metricId string, val
 	if value < 0 {
 		return fmt.Errorf("cannot send negative value %d", value)
 	}
-	body := fmt.Sprintf("value=%d", value)
-	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/inc", []byte(body))
+	body := appendInt(make([]byte, 0, 32), "value=", value)
+	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/inc", body)
 	return err
 }
 
@@ -305,8 +511,8 @@ func (a *Api) PostMetricSetWithContext(ctx context.Context, metricId string, val
 	if value < 0 {
 		return fmt.Errorf("cannot send negative value %d", value)
 	}
-	body := fmt.Sprintf("value=%d", value)
-	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/set", []byte(body))
+	body := appendInt(make([]byte, 0, 32), "value=", value)
+	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/set", body)
 	return err
 }
 
@@ -326,7 +532,28 @@ func (a *Api) PostMetricValuesWithContext(ctx context.Context, metricId string,
 		}
 	}
 	valuesStr := histogram.StringifyValues(values)
-	body := fmt.Sprintf("values=%s", url.QueryEscape(valuesStr))
-	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/values", []byte(body))
+	body := appendQueryEscape(append(make([]byte, 0, 7+3*len(valuesStr)), "values="...), valuesStr)
+	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/values", body)
+	return err
+}
+
+// PostMetricHistogram is like PostMetricHistogramWithContext using context.Background.
+func (a *Api) PostMetricHistogram(metricId string, values *histogram.Values) error {
+	return a.PostMetricHistogramWithContext(context.Background(), metricId, values)
+}
+
+// PostMetricHistogramWithContext is like PostMetricValuesWithContext,
+// but takes compact histogram values, so that values with large
+// counts are never expanded.
+func (a *Api) PostMetricHistogramWithContext(ctx context.Context, metricId string, values *histogram.Values) error {
+	if values == nil {
+		return fmt.Errorf("cannot send nil values")
+	}
+	if values.Len() > 0 && values.Min() < 0 {
+		return fmt.Errorf("cannot send negative value %d", values.Min())
+	}
+	valuesStr := values.String()
+	body := appendQueryEscape(append(make([]byte, 0, 7+3*len(valuesStr)), "values="...), valuesStr)
+	_, err := a.sender.Send(ctx, "POST", "metric/"+metricId+"/values", body)
 	return err
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cvilsmeier/monibot-go/histogram"
 	"github.com/cvilsmeier/monibot-go/internal/assert"
 )
 
@@ -296,6 +297,105 @@ func TestApi(t *testing.T) {
 		is.Eq("POST metric/010101/values values=0%2C1%2C2%2C3%3A3%2C4%2C5%3A2", sender.calls[0])
 		is.Eq(0, len(sender.responses))
 	}
+	// POST metric/00000042/values with compact histogram
+	{
+		sender.calls = nil
+		sender.responses = append(sender.responses, fakeResponse{})
+		var values histogram.Values
+		values.AddN(5, 1000000)
+		values.Add(2)
+		err := api.PostMetricHistogram("00000042", &values)
+		is.Nil(err)
+		is.Eq(1, len(sender.calls))
+		// "2%2C5%3A1000000" = urlEncode("2,5:1000000")
+		is.Eq("POST metric/00000042/values values=2%2C5%3A1000000", sender.calls[0])
+		values.Add(-1)
+		err = api.PostMetricHistogram("00000042", &values)
+		is.Eq("cannot send negative value -1", err.Error())
+		is.Eq(1, len(sender.calls))
+		err = api.PostMetricHistogram("00000042", nil)
+		is.Eq("cannot send nil values", err.Error())
+		is.Eq(1, len(sender.calls))
+	}
+}
+
+func TestManagementApi(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{}
+	api := &Api{sender}
+	// POST watchdogs
+	{
+		sender.calls = nil
+		sender.responses = append(sender.responses, fakeResponse{data: []byte(`{"id":"0001", "name":"Daily Backup", "intervalMillis": 86400000}`)})
+		watchdog, err := api.CreateWatchdog("Daily Backup", 24*time.Hour)
+		is.Nil(err)
+		is.Eq("0001", watchdog.Id)
+		is.Eq(1, len(sender.calls))
+		is.Eq("POST watchdogs intervalMillis=86400000&name=Daily+Backup", sender.calls[0])
+		_, err = api.CreateWatchdog("Daily Backup", 0)
+		is.Eq("cannot send interval 0s", err.Error())
+		_, err = api.CreateWatchdog("", time.Hour)
+		is.Eq("cannot send empty name", err.Error())
+		is.Eq(1, len(sender.calls))
+	}
+	// PUT watchdog/0001
+	{
+		sender.calls = nil
+		sender.responses = append(sender.responses, fakeResponse{data: []byte(`{"id":"0001", "name":"Backup", "intervalMillis": 3600000}`)})
+		watchdog, err := api.UpdateWatchdog("0001", "Backup", time.Hour)
+		is.Nil(err)
+		is.Eq("Backup", watchdog.Name)
+		is.Eq("PUT watchdog/0001 intervalMillis=3600000&name=Backup", sender.calls[0])
+	}
+	// DELETE watchdog/0001
+	{
+		sender.calls = nil
+		sender.responses = append(sender.responses, fakeResponse{})
+		is.Nil(api.DeleteWatchdog("0001"))
+		is.Eq("DELETE watchdog/0001", sender.calls[0])
+	}
+	// machines
+	{
+		sender.calls = nil
+		sender.responses = append(sender.responses,
+			fakeResponse{data: []byte(`{"id":"0002", "name":"web1"}`)},
+			fakeResponse{data: []byte(`{"id":"0002", "name":"web2"}`)},
+			fakeResponse{},
+		)
+		machine, err := api.CreateMachine("web1")
+		is.Nil(err)
+		is.Eq("0002", machine.Id)
+		machine, err = api.UpdateMachine("0002", "web2")
+		is.Nil(err)
+		is.Eq("web2", machine.Name)
+		is.Nil(api.DeleteMachine("0002"))
+		is.Eq(3, len(sender.calls))
+		is.Eq("POST machines name=web1", sender.calls[0])
+		is.Eq("PUT machine/0002 name=web2", sender.calls[1])
+		is.Eq("DELETE machine/0002", sender.calls[2])
+	}
+	// metrics
+	{
+		sender.calls = nil
+		sender.responses = append(sender.responses,
+			fakeResponse{data: []byte(`{"id":"0003", "name":"Logins", "type": 0}`)},
+			fakeResponse{data: []byte(`{"id":"0003", "name":"Sign-ins", "type": 0}`)},
+			fakeResponse{},
+		)
+		metric, err := api.CreateMetric("Logins", MetricTypeCounter)
+		is.Nil(err)
+		is.Eq("0003", metric.Id)
+		metric, err = api.UpdateMetric("0003", "Sign-ins")
+		is.Nil(err)
+		is.Eq("Sign-ins", metric.Name)
+		is.Nil(api.DeleteMetric("0003"))
+		_, err = api.CreateMetric("Logins", 3)
+		is.Eq("cannot send metric type 3", err.Error())
+		is.Eq(3, len(sender.calls))
+		is.Eq("POST metrics name=Logins&type=0", sender.calls[0])
+		is.Eq("PUT metric/0003 name=Sign-ins", sender.calls[1])
+		is.Eq("DELETE metric/0003", sender.calls[2])
+	}
 }
 
 type fakeSender struct {
@@ -318,3 +418,104 @@ type fakeResponse struct {
 	data []byte
 	err  error
 }
+
+func TestEncodeMachineSample(t *testing.T) {
+	is := assert.New(t)
+	sample := benchmarkSample(2, 1)
+	sample.Disks[0].Mountpoint = "/mnt/HC Volume~1"
+	sample.Nets[0].Device = "eth0@if5"
+	buf := EncodeMachineSample([]byte("xyz"), sample)
+	is.Eq("xyz"+
+		"tstamp=1698400800000&load1=1.010&load5=0.780&load15=0.120&cpu=12&mem=34"+
+		"&disks=2"+
+		"&disks[0].device=%2Fdev%2Fsda0&disks[0].mountpoint=%2Fmnt%2FHC+Volume~1&disks[0].total=21&disks[0].used=22&disks[0].usedPercent=23&disks[0].readBytes=24&disks[0].writeBytes=25"+
+		"&disks[1].device=%2Fdev%2Fsda1&disks[1].mountpoint=%2Fmnt%2Fdisk1&disks[1].total=21&disks[1].used=22&disks[1].usedPercent=23&disks[1].readBytes=24&disks[1].writeBytes=25"+
+		"&disk=12&diskRead=678&diskWrite=567"+
+		"&nets=1"+
+		"&nets[0].device=eth0%40if5&nets[0].recvBytes=13&nets[0].sendBytes=14"+
+		"&netRecv=13&netSend=14", string(buf))
+	// allocations do not depend on the number of disks and nets
+	api := &Api{noopSender{}}
+	postAllocs := -1.0
+	for _, n := range []int{0, 1, 10, 100} {
+		sample := benchmarkSample(n, n)
+		is.Eq(0.0, testing.AllocsPerRun(10, func() {
+			buf = EncodeMachineSample(buf[:0], sample)
+		}))
+		allocs := testing.AllocsPerRun(10, func() {
+			api.PostMachineSample("00000001", sample)
+		})
+		if postAllocs < 0 {
+			postAllocs = allocs
+		}
+		if !raceEnabled {
+			is.Eq(postAllocs, allocs)
+		}
+	}
+}
+
+func BenchmarkEncodeMachineSample(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("disks=%d,nets=%d", n, n), func(b *testing.B) {
+			sample := benchmarkSample(n, n)
+			var buf []byte
+			b.ReportAllocs()
+			for range b.N {
+				buf = EncodeMachineSample(buf[:0], sample)
+			}
+		})
+	}
+}
+
+func BenchmarkPostMachineSample(b *testing.B) {
+	api := &Api{noopSender{}}
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("disks=%d,nets=%d", n, n), func(b *testing.B) {
+			sample := benchmarkSample(n, n)
+			b.ReportAllocs()
+			for range b.N {
+				api.PostMachineSample("00000001", sample)
+			}
+		})
+	}
+}
+
+func BenchmarkPostMetricInc(b *testing.B) {
+	api := &Api{noopSender{}}
+	b.ReportAllocs()
+	for range b.N {
+		api.PostMetricInc("00000001", 42)
+	}
+}
+
+// benchmarkSample returns a machine sample with disks and nets.
+func benchmarkSample(disks, nets int) MachineSample {
+	sample := MachineSample{
+		Tstamp:      time.Date(2023, 10, 27, 10, 0, 0, 0, time.UTC).UnixMilli(),
+		Load1:       1.01,
+		Load5:       0.78,
+		Load15:      0.12,
+		CpuPercent:  12,
+		MemPercent:  34,
+		DiskPercent: 12,
+		DiskRead:    678,
+		DiskWrite:   567,
+		NetRecv:     13,
+		NetSend:     14,
+	}
+	for i := range disks {
+		sample.Disks = append(sample.Disks, DiskSample{
+			Device:      fmt.Sprintf("/dev/sda%d", i),
+			Mountpoint:  fmt.Sprintf("/mnt/disk%d", i),
+			Total:       21,
+			Used:        22,
+			UsedPercent: 23,
+			ReadBytes:   24,
+			WriteBytes:  25,
+		})
+	}
+	for i := range nets {
+		sample.Nets = append(sample.Nets, NetSample{Device: fmt.Sprintf("eth%d", i), RecvBytes: 13, SendBytes: 14})
+	}
+	return sample
+}
@@ -0,0 +1,37 @@
+package monibot
+
+import (
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/sending"
+)
+
+// A CircuitBreaker stops an Api from sending requests while the
+// Monibot API is down, so that API calls fail fast instead of
+// blocking for all trials. Use it with ApiOptions.CircuitBreaker.
+//
+// After threshold consecutive trials have failed with a network
+// error or status 5xx, the breaker opens, and API calls fail at once
+// with an ApiError that matches ErrCircuitOpen. After a cool-down
+// period, the breaker lets one probe request through (half-open).
+// If the probe succeeds, the breaker closes, otherwise it opens again.
+//
+// A CircuitBreaker is safe for concurrent use and can be shared by
+// several Api instances. Its State method can be used for health
+// endpoints.
+type CircuitBreaker = sending.Breaker
+
+// A BreakerState is the state of a CircuitBreaker.
+type BreakerState = sending.BreakerState
+
+const (
+	BreakerClosed   = sending.BreakerClosed   // Requests are sent.
+	BreakerOpen     = sending.BreakerOpen     // Requests fail fast.
+	BreakerHalfOpen = sending.BreakerHalfOpen // One probe request is sent.
+)
+
+// NewCircuitBreaker creates a CircuitBreaker that opens after
+// threshold consecutive failed trials and stays open for coolDown.
+func NewCircuitBreaker(threshold int, coolDown time.Duration) *CircuitBreaker {
+	return sending.NewBreaker(threshold, coolDown, time.Now)
+}
@@ -0,0 +1,37 @@
+package monibot_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+	"github.com/cvilsmeier/monibot-go/monibottest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 60_000})
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := monibot.NewCircuitBreakerWithClock(2, time.Minute, func() time.Time { return clock })
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl:     srv.URL,
+		Delay:          time.Millisecond,
+		CircuitBreaker: breaker,
+	})
+	srv.FailNext(2, 503, 0)
+	err := api.PostWatchdogHeartbeat("w1")
+	is.Eq("status 503: 503 - Service Unavailable (injected fault)", err.Error())
+	is.True(!errors.Is(err, monibot.ErrRetriesExhausted))
+	is.Eq(monibot.BreakerOpen, breaker.State())
+	is.True(errors.Is(api.PostWatchdogHeartbeat("w1"), monibot.ErrCircuitOpen))
+	is.Eq(2, srv.Requests())
+	clock = clock.Add(time.Minute)
+	is.Eq(monibot.BreakerHalfOpen, breaker.State())
+	is.Nil(api.PostWatchdogHeartbeat("w1"))
+	is.Eq(monibot.BreakerClosed, breaker.State())
+	is.Eq(1, srv.Heartbeats("w1"))
+}
@@ -0,0 +1,315 @@
+package monibot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/histogram"
+)
+
+// ErrBufferedApiClosed is returned if values are posted to
+// a BufferedApi that has been closed.
+var ErrBufferedApiClosed = errors.New("buffered api closed")
+
+// A DropPolicy decides what a BufferedApi does if its queue is full.
+type DropPolicy int
+
+const (
+	DropNewest DropPolicy = iota // Discard the value that is being posted.
+	DropOldest                   // Discard the oldest queued value to make room.
+	DropNever                    // Wait until there is room in the queue.
+)
+
+// BufferedApiOptions holds optional parameters for a BufferedApi.
+type BufferedApiOptions struct {
+
+	// Default is no logging.
+	Logger Logger
+
+	// The interval in which buffered values are sent to the API.
+	// Default is 30s.
+	FlushInterval time.Duration
+
+	// The maximum number of queued values that have not yet
+	// been aggregated.
+	// Default is 1000.
+	QueueSize int
+
+	// What to do if the queue is full.
+	// Default is DropNewest.
+	DropPolicy DropPolicy
+}
+
+// A BufferedApi collects metric values in memory and sends them
+// periodically through an Api. Posting a value never waits for
+// the network, so it can be used in request handlers.
+//
+// Counter increments are summed up per metric, for gauges only the
+// last value is kept, and histogram values are accumulated.
+//
+// A BufferedApi is safe for concurrent use. Call Close to send
+// the remaining values and stop the background goroutine.
+type BufferedApi struct {
+	api        Client
+	logger     Logger
+	interval   time.Duration
+	dropPolicy DropPolicy
+	queue      chan bufferedValue
+	flushes    chan flushRequest
+	closes     chan flushRequest
+	mu         sync.RWMutex // held by enqueue while it checks closed and queues a value
+	closed     bool
+	closeOnce  sync.Once
+	done       chan struct{}
+	ctx        context.Context // for periodic flushes, cancelled on Close
+	cancel     context.CancelFunc
+	dropped    atomic.Int64
+	// pending values, owned by the run goroutine
+	counters   map[string]int64
+	gauges     map[string]int64
+	histograms map[string]*histogram.Values
+}
+
+type bufferedValue struct {
+	metricType int
+	metricId   string
+	value      int64
+	values     []int64
+}
+
+type flushRequest struct {
+	ctx   context.Context
+	reply chan error
+}
+
+// NewBufferedApi creates a BufferedApi that sends through api
+// and starts its background goroutine.
+func NewBufferedApi(api Client, options BufferedApiOptions) *BufferedApi {
+	b := newBufferedApi(api, options)
+	go b.run()
+	return b
+}
+
+func newBufferedApi(api Client, options BufferedApiOptions) *BufferedApi {
+	logger := options.Logger
+	if logger == nil {
+		logger = zeroLogger{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BufferedApi{
+		api:        api,
+		logger:     logger,
+		interval:   cmp.Or(options.FlushInterval, 30*time.Second),
+		dropPolicy: options.DropPolicy,
+		queue:      make(chan bufferedValue, cmp.Or(options.QueueSize, 1000)),
+		flushes:    make(chan flushRequest),
+		closes:     make(chan flushRequest),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]int64),
+		histograms: make(map[string]*histogram.Values),
+	}
+}
+
+// PostMetricInc queues a counter metric increment value.
+// The value is a non-negative int64 number.
+func (b *BufferedApi) PostMetricInc(metricId string, value int64) error {
+	if value < 0 {
+		return fmt.Errorf("cannot send negative value %d", value)
+	}
+	return b.enqueue(bufferedValue{metricType: MetricTypeCounter, metricId: metricId, value: value})
+}
+
+// PostMetricSet queues a gauge metric value.
+// The value is a non-negative int64 number.
+func (b *BufferedApi) PostMetricSet(metricId string, value int64) error {
+	if value < 0 {
+		return fmt.Errorf("cannot send negative value %d", value)
+	}
+	return b.enqueue(bufferedValue{metricType: MetricTypeGauge, metricId: metricId, value: value})
+}
+
+// PostMetricValues queues histogram metric values.
+// Each value must be a non-negative int64 number.
+func (b *BufferedApi) PostMetricValues(metricId string, values []int64) error {
+	for _, value := range values {
+		if value < 0 {
+			return fmt.Errorf("cannot send negative value %d", value)
+		}
+	}
+	values = slices.Clone(values)
+	return b.enqueue(bufferedValue{metricType: MetricTypeHistogram, metricId: metricId, values: values})
+}
+
+// Dropped returns the number of values that were discarded
+// because the queue was full.
+func (b *BufferedApi) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+func (b *BufferedApi) enqueue(v bufferedValue) error {
+	// Close waits until the value is queued, so that it is
+	// drained before the final flush
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrBufferedApiClosed
+	}
+	switch b.dropPolicy {
+	case DropNever:
+		b.queue <- v // the run goroutine drains the queue until Close
+	case DropOldest:
+		for {
+			select {
+			case b.queue <- v:
+				return nil
+			default:
+			}
+			select {
+			case <-b.queue:
+				b.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case b.queue <- v:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Flush sends all buffered values to the API and waits until
+// they are sent or ctx is done.
+func (b *BufferedApi) Flush(ctx context.Context) error {
+	return b.request(ctx, b.flushes)
+}
+
+// Close sends all buffered values to the API, waits until they
+// are sent or ctx is done, and stops the background goroutine.
+// Values posted after Close are rejected with ErrBufferedApiClosed.
+func (b *BufferedApi) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		b.mu.Lock()
+		b.closed = true
+		b.mu.Unlock()
+		b.cancel()
+	})
+	return b.request(ctx, b.closes)
+}
+
+func (b *BufferedApi) request(ctx context.Context, requests chan flushRequest) error {
+	req := flushRequest{ctx, make(chan error, 1)}
+	select {
+	case requests <- req:
+	case <-b.done:
+		return ErrBufferedApiClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *BufferedApi) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case v := <-b.queue:
+			b.add(v)
+		case <-ticker.C:
+			b.drain()
+			if err := b.flush(b.ctx); err != nil {
+				b.logger.Debug("cannot flush: %s", err)
+			}
+		case req := <-b.flushes:
+			b.drain()
+			req.reply <- b.flush(req.ctx)
+		case req := <-b.closes:
+			b.drain()
+			req.reply <- b.flush(req.ctx)
+			return
+		}
+	}
+}
+
+// drain aggregates all queued values.
+func (b *BufferedApi) drain() {
+	for {
+		select {
+		case v := <-b.queue:
+			b.add(v)
+		default:
+			return
+		}
+	}
+}
+
+func (b *BufferedApi) add(v bufferedValue) {
+	switch v.metricType {
+	case MetricTypeCounter:
+		b.counters[v.metricId] += v.value
+	case MetricTypeGauge:
+		b.gauges[v.metricId] = v.value
+	case MetricTypeHistogram:
+		h := b.histograms[v.metricId]
+		if h == nil {
+			h = &histogram.Values{}
+			b.histograms[v.metricId] = h
+		}
+		for _, value := range v.values {
+			h.Add(value)
+		}
+	}
+}
+
+// flush sends all pending values. Values that could not be sent
+// because ctx was cancelled are kept for the next flush, values
+// that could not be sent for other reasons are discarded.
+func (b *BufferedApi) flush(ctx context.Context) error {
+	counters, gauges, histograms := b.counters, b.gauges, b.histograms
+	b.counters = make(map[string]int64)
+	b.gauges = make(map[string]int64)
+	b.histograms = make(map[string]*histogram.Values)
+	var errs []error
+	keep := func(err error) bool {
+		if err == nil {
+			return false
+		}
+		errs = append(errs, err)
+		return ctx.Err() != nil
+	}
+	for _, id := range slices.Sorted(maps.Keys(counters)) {
+		if keep(b.api.PostMetricIncWithContext(ctx, id, counters[id])) {
+			b.counters[id] = counters[id]
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(gauges)) {
+		if keep(b.api.PostMetricSetWithContext(ctx, id, gauges[id])) {
+			b.gauges[id] = gauges[id]
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(histograms)) {
+		if keep(b.api.PostMetricHistogramWithContext(ctx, id, histograms[id])) {
+			b.histograms[id] = histograms[id]
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+package monibot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestBufferedApi(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{}
+	api := &Api{sender}
+	buf := NewBufferedApi(api, BufferedApiOptions{FlushInterval: time.Hour})
+	// counters are summed, gauges keep last value, histograms accumulate
+	is.Nil(buf.PostMetricInc("c1", 2))
+	is.Nil(buf.PostMetricInc("c1", 3))
+	is.Nil(buf.PostMetricInc("c0", 1))
+	is.Nil(buf.PostMetricSet("g1", 10))
+	is.Nil(buf.PostMetricSet("g1", 11))
+	is.Nil(buf.PostMetricValues("h1", []int64{3, 1}))
+	is.Nil(buf.PostMetricValues("h1", []int64{3}))
+	is.Eq("cannot send negative value -1", buf.PostMetricInc("c1", -1).Error())
+	sender.responses = []fakeResponse{{}, {}, {}, {}}
+	is.Nil(buf.Flush(context.Background()))
+	is.Eq(4, len(sender.calls))
+	is.Eq("POST metric/c0/inc value=1", sender.calls[0])
+	is.Eq("POST metric/c1/inc value=5", sender.calls[1])
+	is.Eq("POST metric/g1/set value=11", sender.calls[2])
+	is.Eq("POST metric/h1/values values=1%2C3%3A2", sender.calls[3])
+	sender.calls = nil
+	// nothing to flush
+	is.Nil(buf.Flush(context.Background()))
+	is.Eq(0, len(sender.calls))
+	// failed sends are reported and discarded
+	is.Nil(buf.PostMetricInc("c1", 7))
+	sender.responses = []fakeResponse{{nil, errors.New("status 404")}}
+	is.Eq("status 404", buf.Flush(context.Background()).Error())
+	is.Eq(1, len(sender.calls))
+	sender.calls = nil
+	// close flushes remaining values
+	is.Nil(buf.PostMetricSet("g1", 12))
+	sender.responses = []fakeResponse{{}}
+	is.Nil(buf.Close(context.Background()))
+	is.Eq(1, len(sender.calls))
+	is.Eq("POST metric/g1/set value=12", sender.calls[0])
+	// closed api rejects values
+	is.Eq(ErrBufferedApiClosed, buf.PostMetricInc("c1", 1))
+	is.Eq(ErrBufferedApiClosed, buf.Flush(context.Background()))
+	is.Eq(ErrBufferedApiClosed, buf.Close(context.Background()))
+}
+
+func TestBufferedApiDropPolicy(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{}
+	api := &Api{sender}
+	// drop newest
+	buf := newBufferedApi(api, BufferedApiOptions{QueueSize: 2})
+	is.Nil(buf.PostMetricSet("g1", 1))
+	is.Nil(buf.PostMetricSet("g1", 2))
+	is.Nil(buf.PostMetricSet("g1", 3))
+	is.Eq(int64(1), buf.Dropped())
+	go buf.run()
+	sender.responses = []fakeResponse{{}}
+	is.Nil(buf.Close(context.Background()))
+	is.Eq("POST metric/g1/set value=2", sender.calls[0])
+	sender.calls = nil
+	// drop oldest
+	buf = newBufferedApi(api, BufferedApiOptions{QueueSize: 2, DropPolicy: DropOldest})
+	is.Nil(buf.PostMetricSet("g1", 1))
+	is.Nil(buf.PostMetricSet("g1", 2))
+	is.Nil(buf.PostMetricSet("g1", 3))
+	is.Nil(buf.PostMetricInc("c1", 4))
+	is.Eq(int64(2), buf.Dropped())
+	go buf.run()
+	sender.responses = []fakeResponse{{}, {}}
+	is.Nil(buf.Close(context.Background()))
+	is.Eq("POST metric/c1/inc value=4", sender.calls[0])
+	is.Eq("POST metric/g1/set value=3", sender.calls[1])
+	sender.calls = nil
+	// drop never
+	buf = newBufferedApi(api, BufferedApiOptions{QueueSize: 1, DropPolicy: DropNever})
+	is.Nil(buf.PostMetricInc("c1", 1))
+	posted := make(chan error)
+	go func() {
+		posted <- buf.PostMetricInc("c1", 2)
+	}()
+	select {
+	case <-posted:
+		t.Fatal("post must block while queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	go buf.run()
+	is.Nil(<-posted)
+	sender.responses = []fakeResponse{{}}
+	is.Nil(buf.Close(context.Background()))
+	is.Eq("POST metric/c1/inc value=3", sender.calls[0])
+	is.Eq(int64(0), buf.Dropped())
+}
+
+func TestBufferedApiCloseWhilePosting(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{responses: []fakeResponse{{}}}
+	api := &Api{sender}
+	buf := NewBufferedApi(api, BufferedApiOptions{FlushInterval: time.Hour, QueueSize: 1_000_000})
+	// every value that was accepted and not dropped is sent by Close
+	var accepted atomic.Int64
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for buf.PostMetricInc("c1", 1) == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	is.Nil(buf.Close(context.Background()))
+	wg.Wait()
+	is.True(accepted.Load() > 0)
+	is.Eq(1, len(sender.calls))
+	is.Eq(fmt.Sprintf("POST metric/c1/inc value=%d", accepted.Load()-buf.Dropped()), sender.calls[0])
+}
@@ -0,0 +1,147 @@
+package monibot
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/histogram"
+)
+
+// Client is the interface implemented by Api. Depend on Client
+// instead of *Api if you want to substitute a fake or decorate
+// the API calls.
+type Client interface {
+	GetPing() error
+	GetPingWithContext(ctx context.Context) error
+	GetWatchdogs() ([]Watchdog, error)
+	GetWatchdogsWithContext(ctx context.Context) ([]Watchdog, error)
+	GetWatchdog(watchdogId string) (Watchdog, error)
+	GetWatchdogWithContext(ctx context.Context, watchdogId string) (Watchdog, error)
+	CreateWatchdog(name string, interval time.Duration) (Watchdog, error)
+	CreateWatchdogWithContext(ctx context.Context, name string, interval time.Duration) (Watchdog, error)
+	UpdateWatchdog(watchdogId string, name string, interval time.Duration) (Watchdog, error)
+	UpdateWatchdogWithContext(ctx context.Context, watchdogId string, name string, interval time.Duration) (Watchdog, error)
+	DeleteWatchdog(watchdogId string) error
+	DeleteWatchdogWithContext(ctx context.Context, watchdogId string) error
+	PostWatchdogHeartbeat(watchdogId string) error
+	PostWatchdogHeartbeatWithContext(ctx context.Context, watchdogId string) error
+	GetMachines() ([]Machine, error)
+	GetMachinesWithContext(ctx context.Context) ([]Machine, error)
+	GetMachine(machineId string) (Machine, error)
+	GetMachineWithContext(ctx context.Context, machineId string) (Machine, error)
+	CreateMachine(name string) (Machine, error)
+	CreateMachineWithContext(ctx context.Context, name string) (Machine, error)
+	UpdateMachine(machineId string, name string) (Machine, error)
+	UpdateMachineWithContext(ctx context.Context, machineId string, name string) (Machine, error)
+	DeleteMachine(machineId string) error
+	DeleteMachineWithContext(ctx context.Context, machineId string) error
+	PostMachineSample(machineId string, sample MachineSample) error
+	PostMachineSampleWithContext(ctx context.Context, machineId string, sample MachineSample) error
+	PostMachineText(machineId string, text string) error
+	PostMachineTextWithContext(ctx context.Context, machineId string, text string) error
+	GetMetrics() ([]Metric, error)
+	GetMetricsWithContext(ctx context.Context) ([]Metric, error)
+	GetMetric(metricId string) (Metric, error)
+	GetMetricWithContext(ctx context.Context, metricId string) (Metric, error)
+	CreateMetric(name string, metricType int) (Metric, error)
+	CreateMetricWithContext(ctx context.Context, name string, metricType int) (Metric, error)
+	UpdateMetric(metricId string, name string) (Metric, error)
+	UpdateMetricWithContext(ctx context.Context, metricId string, name string) (Metric, error)
+	DeleteMetric(metricId string) error
+	DeleteMetricWithContext(ctx context.Context, metricId string) error
+	PostMetricInc(metricId string, value int64) error
+	PostMetricIncWithContext(ctx context.Context, metricId string, value int64) error
+	PostMetricSet(metricId string, value int64) error
+	PostMetricSetWithContext(ctx context.Context, metricId string, value int64) error
+	PostMetricValues(metricId string, values []int64) error
+	PostMetricValuesWithContext(ctx context.Context, metricId string, values []int64) error
+	PostMetricHistogram(metricId string, values *histogram.Values) error
+	PostMetricHistogramWithContext(ctx context.Context, metricId string, values *histogram.Values) error
+}
+
+var _ Client = (*Api)(nil)
+
+// NewNoopClient creates a Client that sends nothing. Its Post methods
+// always succeed, its Get methods return empty results. Lookups like
+// LookupGauge do not check the metric type.
+func NewNoopClient() Client {
+	return &Api{noopSender{}}
+}
+
+// A noopSender responds to each request with JSON null,
+// which decodes into empty results.
+type noopSender struct{}
+
+func (noopSender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// NewDryRunClient creates a Client that sends nothing but logs each
+// request, e.g. "POST metric/ffe31498bc7193a4/inc value=42".
+// Its Post methods always succeed, its Get methods return empty results.
+// Lookups like LookupGauge do not check the metric type.
+func NewDryRunClient(logger Logger) Client {
+	if logger == nil {
+		logger = zeroLogger{}
+	}
+	return &Api{dryRunSender{logger}}
+}
+
+type dryRunSender struct {
+	logger Logger
+}
+
+func (s dryRunSender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	s.logger.Debug("dry-run: %s", formatCall(method, path, body))
+	return []byte("null"), nil
+}
+
+// A RecordingClient is a Client that sends nothing but records each
+// request. Its Post methods always succeed, its Get methods return
+// empty results. Lookups like LookupGauge do not check the metric
+// type. It is safe for concurrent use.
+type RecordingClient struct {
+	*Api
+	sender *recordingSender
+}
+
+// NewRecordingClient creates a RecordingClient.
+func NewRecordingClient() *RecordingClient {
+	sender := &recordingSender{}
+	return &RecordingClient{&Api{sender}, sender}
+}
+
+// Calls returns the recorded requests in the order they were made,
+// e.g. "POST metric/ffe31498bc7193a4/inc value=42".
+func (c *RecordingClient) Calls() []string {
+	c.sender.mu.Lock()
+	defer c.sender.mu.Unlock()
+	return slices.Clone(c.sender.calls)
+}
+
+// Reset clears the recorded requests.
+func (c *RecordingClient) Reset() {
+	c.sender.mu.Lock()
+	defer c.sender.mu.Unlock()
+	c.sender.calls = nil
+}
+
+type recordingSender struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (s *recordingSender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, formatCall(method, path, body))
+	return []byte("null"), nil
+}
+
+// formatCall formats a request like "POST metric/ffe31498bc7193a4/inc value=42".
+func formatCall(method, path string, body []byte) string {
+	return strings.TrimSpace(method + " " + path + " " + string(body))
+}
@@ -0,0 +1,68 @@
+package monibot
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestClients(t *testing.T) {
+	is := assert.New(t)
+	// noop
+	noop := NewNoopClient()
+	is.Nil(noop.PostMetricInc("c1", 1))
+	watchdogs, err := noop.GetWatchdogs()
+	is.Nil(err)
+	is.Eq(0, len(watchdogs))
+	metric, err := noop.GetMetric("m1")
+	is.Nil(err)
+	is.Eq("", metric.Id)
+	_, err = LookupGauge(noop, "g1")
+	is.Nil(err)
+	_, err = LookupHistogram(noop, "h1")
+	is.Nil(err)
+	_, err = LookupGauge(wrappedClient{noop}, "g1")
+	is.Nil(err)
+	// dry-run
+	logger := &recordingLogger{}
+	dryRun := NewDryRunClient(logger)
+	is.Nil(dryRun.PostMetricSet("g1", 42))
+	is.Nil(dryRun.GetPing())
+	_, err = LookupGauge(dryRun, "g1")
+	is.Nil(err)
+	is.Eq(3, len(logger.lines))
+	is.Eq("dry-run: POST metric/g1/set value=42", logger.lines[0])
+	is.Eq("dry-run: GET ping", logger.lines[1])
+	is.Eq("dry-run: GET metric/g1", logger.lines[2])
+	// recording
+	recording := NewRecordingClient()
+	counter := NewCounter(recording, "c1")
+	is.Nil(counter.Add(3))
+	is.Nil(recording.PostWatchdogHeartbeat("w1"))
+	histogram, err := LookupHistogram(recording, "h1")
+	is.Nil(err)
+	is.Nil(histogram.Observe(5))
+	calls := recording.Calls()
+	is.Eq(4, len(calls))
+	is.Eq("POST metric/c1/inc value=3", calls[0])
+	is.Eq("POST watchdog/w1/heartbeat", calls[1])
+	is.Eq("GET metric/h1", calls[2])
+	is.Eq("POST metric/h1/values values=5", calls[3])
+	recording.Reset()
+	is.Eq(0, len(recording.Calls()))
+}
+
+// wrappedClient is a user-defined Client decorator.
+type wrappedClient struct {
+	Client
+}
+
+// recordingLogger is a Logger for unit tests
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Debug(format string, args ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,94 @@
+package monibot
+
+import (
+	"strconv"
+	"sync"
+)
+
+// EncodeMachineSample appends the form-encoded body of
+// PostMachineSample to dst and returns the extended buffer, e.g.
+// "tstamp=1698400800000&load1=1.010&...&netSend=14". Pass a
+// buffer with spare capacity, e.g. dst[:0] of the previous call,
+// to encode samples without allocating.
+func EncodeMachineSample(dst []byte, s MachineSample) []byte {
+	dst = appendInt(dst, "tstamp=", s.Tstamp)
+	dst = appendFloat(dst, "&load1=", s.Load1)
+	dst = appendFloat(dst, "&load5=", s.Load5)
+	dst = appendFloat(dst, "&load15=", s.Load15)
+	dst = appendInt(dst, "&cpu=", int64(s.CpuPercent))
+	dst = appendInt(dst, "&mem=", int64(s.MemPercent))
+	if len(s.Disks) > 0 {
+		dst = appendInt(dst, "&disks=", int64(len(s.Disks))) // number of disks, default is 0
+		for i, disk := range s.Disks {
+			dst = appendIndexed(dst, "disks", i, "device=")
+			dst = appendQueryEscape(dst, disk.Device)
+			dst = appendIndexed(dst, "disks", i, "mountpoint=")
+			dst = appendQueryEscape(dst, disk.Mountpoint)
+			dst = strconv.AppendInt(appendIndexed(dst, "disks", i, "total="), disk.Total, 10)
+			dst = strconv.AppendInt(appendIndexed(dst, "disks", i, "used="), disk.Used, 10)
+			dst = strconv.AppendInt(appendIndexed(dst, "disks", i, "usedPercent="), int64(disk.UsedPercent), 10)
+			dst = strconv.AppendInt(appendIndexed(dst, "disks", i, "readBytes="), disk.ReadBytes, 10)
+			dst = strconv.AppendInt(appendIndexed(dst, "disks", i, "writeBytes="), disk.WriteBytes, 10)
+		}
+	}
+	dst = appendInt(dst, "&disk=", int64(s.DiskPercent))
+	dst = appendInt(dst, "&diskRead=", s.DiskRead)
+	dst = appendInt(dst, "&diskWrite=", s.DiskWrite)
+	if len(s.Nets) > 0 {
+		dst = appendInt(dst, "&nets=", int64(len(s.Nets))) // number of nets, default is 0
+		for i, net := range s.Nets {
+			dst = appendIndexed(dst, "nets", i, "device=")
+			dst = appendQueryEscape(dst, net.Device)
+			dst = strconv.AppendInt(appendIndexed(dst, "nets", i, "recvBytes="), net.RecvBytes, 10)
+			dst = strconv.AppendInt(appendIndexed(dst, "nets", i, "sendBytes="), net.SendBytes, 10)
+		}
+	}
+	dst = appendInt(dst, "&netRecv=", s.NetRecv)
+	dst = appendInt(dst, "&netSend=", s.NetSend)
+	return dst
+}
+
+// sampleBuffers holds buffers for encoding machine samples, so that
+// PostMachineSample does not allocate a body for each call.
+var sampleBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// maxSampleBuffer is the capacity above which a buffer is not put
+// back into sampleBuffers, so that one huge sample does not pin memory.
+const maxSampleBuffer = 64 * 1024
+
+// appendInt appends a key like "&cpu=" and an integer value.
+func appendInt(dst []byte, key string, value int64) []byte {
+	return strconv.AppendInt(append(dst, key...), value, 10)
+}
+
+// appendFloat appends a key like "&load1=" and a float value with 3 decimals.
+func appendFloat(dst []byte, key string, value float64) []byte {
+	return strconv.AppendFloat(append(dst, key...), value, 'f', 3, 64)
+}
+
+// appendIndexed appends a key like "&disks[2].device=".
+func appendIndexed(dst []byte, name string, index int, field string) []byte {
+	dst = append(dst, '&')
+	dst = append(dst, name...)
+	dst = append(dst, '[')
+	dst = strconv.AppendInt(dst, int64(index), 10)
+	dst = append(dst, "]."...)
+	return append(dst, field...)
+}
+
+// appendQueryEscape appends s escaped like url.QueryEscape.
+func appendQueryEscape(dst []byte, s string) []byte {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			dst = append(dst, c)
+		case c == ' ':
+			dst = append(dst, '+')
+		default:
+			dst = append(dst, '%', hex[c>>4], hex[c&15])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,30 @@
+package monibot
+
+import "github.com/cvilsmeier/monibot-go/internal/sending"
+
+// An ApiError is returned if an API call did not succeed.
+// It carries the HTTP status, the response body, the request
+// method and path, the number of trials and the last network error.
+// Use errors.As to access it, and errors.Is to check it against
+// ErrUnauthorized, ErrNotFound, ErrRateLimited, ErrRetriesExhausted
+// or ErrCircuitOpen.
+type ApiError = sending.ApiError
+
+var (
+	// ErrUnauthorized matches an ApiError with status 401, e.g. an invalid apiKey.
+	ErrUnauthorized = sending.ErrUnauthorized
+
+	// ErrNotFound matches an ApiError with status 404.
+	ErrNotFound = sending.ErrNotFound
+
+	// ErrRateLimited matches an ApiError with status 429.
+	ErrRateLimited = sending.ErrRateLimited
+
+	// ErrRetriesExhausted matches an ApiError that was returned
+	// because all trials failed with a retryable error.
+	ErrRetriesExhausted = sending.ErrRetriesExhausted
+
+	// ErrCircuitOpen matches an ApiError that was returned without
+	// sending a request, because the CircuitBreaker was open.
+	ErrCircuitOpen = sending.ErrCircuitOpen
+)
@@ -0,0 +1,13 @@
+package monibot
+
+import (
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/sending"
+)
+
+// NewCircuitBreakerWithClock is like NewCircuitBreaker but uses now
+// instead of time.Now, so tests need not sleep.
+func NewCircuitBreakerWithClock(threshold int, coolDown time.Duration, now func() time.Time) *CircuitBreaker {
+	return sending.NewBreaker(threshold, coolDown, now)
+}
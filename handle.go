@@ -0,0 +1,183 @@
+package monibot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMetricType is returned by LookupCounter, LookupGauge and
+// LookupHistogram if a metric does not have the expected type.
+// The type is not checked if the client returns an empty metric,
+// e.g. a noop client.
+var ErrMetricType = errors.New("wrong metric type")
+
+// A Counter is a handle for a counter metric.
+type Counter struct {
+	api      Client
+	metricId string
+}
+
+// NewCounter creates a Counter handle for a metric without
+// checking the metric type. See LookupCounter.
+func NewCounter(api Client, metricId string) *Counter {
+	return &Counter{api, metricId}
+}
+
+// LookupCounter is like LookupCounterWithContext using context.Background.
+func LookupCounter(api Client, metricId string) (*Counter, error) {
+	return LookupCounterWithContext(context.Background(), api, metricId)
+}
+
+// LookupCounterWithContext fetches a metric and creates a Counter
+// handle for it. It returns an error if the metric cannot be
+// fetched or is not a counter metric.
+func LookupCounterWithContext(ctx context.Context, api Client, metricId string) (*Counter, error) {
+	if err := checkMetricType(ctx, api, metricId, MetricTypeCounter); err != nil {
+		return nil, err
+	}
+	return NewCounter(api, metricId), nil
+}
+
+// MetricId returns the id of the counter metric.
+func (c *Counter) MetricId() string {
+	return c.metricId
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() error {
+	return c.Add(1)
+}
+
+// Add is like AddWithContext using context.Background.
+func (c *Counter) Add(value int64) error {
+	return c.AddWithContext(context.Background(), value)
+}
+
+// AddWithContext increments the counter by a non-negative value.
+func (c *Counter) AddWithContext(ctx context.Context, value int64) error {
+	return c.api.PostMetricIncWithContext(ctx, c.metricId, value)
+}
+
+// A Gauge is a handle for a gauge metric.
+type Gauge struct {
+	api      Client
+	metricId string
+}
+
+// NewGauge creates a Gauge handle for a metric without
+// checking the metric type. See LookupGauge.
+func NewGauge(api Client, metricId string) *Gauge {
+	return &Gauge{api, metricId}
+}
+
+// LookupGauge is like LookupGaugeWithContext using context.Background.
+func LookupGauge(api Client, metricId string) (*Gauge, error) {
+	return LookupGaugeWithContext(context.Background(), api, metricId)
+}
+
+// LookupGaugeWithContext fetches a metric and creates a Gauge
+// handle for it. It returns an error if the metric cannot be
+// fetched or is not a gauge metric.
+func LookupGaugeWithContext(ctx context.Context, api Client, metricId string) (*Gauge, error) {
+	if err := checkMetricType(ctx, api, metricId, MetricTypeGauge); err != nil {
+		return nil, err
+	}
+	return NewGauge(api, metricId), nil
+}
+
+// MetricId returns the id of the gauge metric.
+func (g *Gauge) MetricId() string {
+	return g.metricId
+}
+
+// Set is like SetWithContext using context.Background.
+func (g *Gauge) Set(value int64) error {
+	return g.SetWithContext(context.Background(), value)
+}
+
+// SetWithContext sets the gauge to a non-negative value.
+func (g *Gauge) SetWithContext(ctx context.Context, value int64) error {
+	return g.api.PostMetricSetWithContext(ctx, g.metricId, value)
+}
+
+// A Histogram is a handle for a histogram metric.
+type Histogram struct {
+	api      Client
+	metricId string
+}
+
+// NewHistogram creates a Histogram handle for a metric without
+// checking the metric type. See LookupHistogram.
+func NewHistogram(api Client, metricId string) *Histogram {
+	return &Histogram{api, metricId}
+}
+
+// LookupHistogram is like LookupHistogramWithContext using context.Background.
+func LookupHistogram(api Client, metricId string) (*Histogram, error) {
+	return LookupHistogramWithContext(context.Background(), api, metricId)
+}
+
+// LookupHistogramWithContext fetches a metric and creates a Histogram
+// handle for it. It returns an error if the metric cannot be
+// fetched or is not a histogram metric.
+func LookupHistogramWithContext(ctx context.Context, api Client, metricId string) (*Histogram, error) {
+	if err := checkMetricType(ctx, api, metricId, MetricTypeHistogram); err != nil {
+		return nil, err
+	}
+	return NewHistogram(api, metricId), nil
+}
+
+// MetricId returns the id of the histogram metric.
+func (h *Histogram) MetricId() string {
+	return h.metricId
+}
+
+// Observe is like ObserveWithContext using context.Background.
+func (h *Histogram) Observe(values ...int64) error {
+	return h.ObserveWithContext(context.Background(), values...)
+}
+
+// ObserveWithContext sends non-negative values to the histogram.
+func (h *Histogram) ObserveWithContext(ctx context.Context, values ...int64) error {
+	return h.api.PostMetricValuesWithContext(ctx, h.metricId, values)
+}
+
+// ObserveDuration is like ObserveDurationWithContext using context.Background.
+func (h *Histogram) ObserveDuration(d time.Duration) error {
+	return h.ObserveDurationWithContext(context.Background(), d)
+}
+
+// ObserveDurationWithContext sends a duration in milliseconds to the
+// histogram. Negative durations are sent as 0.
+func (h *Histogram) ObserveDurationWithContext(ctx context.Context, d time.Duration) error {
+	return h.ObserveWithContext(ctx, max(d.Milliseconds(), 0))
+}
+
+func checkMetricType(ctx context.Context, api Client, metricId string, metricType int) error {
+	metric, err := api.GetMetricWithContext(ctx, metricId)
+	if err != nil {
+		return err
+	}
+	if metric.Id == "" {
+		// no data, e.g. from a noop client, the type cannot be checked
+		return nil
+	}
+	if metric.Type != metricType {
+		return fmt.Errorf("%w: metric %s %q is a %s, not a %s", ErrMetricType, metricId, metric.Name, metricTypeName(metric.Type), metricTypeName(metricType))
+	}
+	return nil
+}
+
+func metricTypeName(metricType int) string {
+	switch metricType {
+	case MetricTypeCounter:
+		return "counter"
+	case MetricTypeGauge:
+		return "gauge"
+	case MetricTypeHistogram:
+		return "histogram"
+	}
+	return fmt.Sprintf("type %d", metricType)
+}
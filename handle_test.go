@@ -0,0 +1,60 @@
+package monibot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestHandles(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{}
+	api := &Api{sender}
+	// counter
+	sender.responses = []fakeResponse{{data: []byte(`{"id":"01", "name":"Logins", "type": 0}`)}, {}, {}}
+	counter, err := LookupCounter(api, "01")
+	is.Nil(err)
+	is.Eq("01", counter.MetricId())
+	is.Nil(counter.Inc())
+	is.Nil(counter.Add(42))
+	is.Eq(3, len(sender.calls))
+	is.Eq("GET metric/01", sender.calls[0])
+	is.Eq("POST metric/01/inc value=1", sender.calls[1])
+	is.Eq("POST metric/01/inc value=42", sender.calls[2])
+	sender.calls = nil
+	// gauge
+	sender.responses = []fakeResponse{{data: []byte(`{"id":"02", "name":"Users", "type": 1}`)}, {}}
+	gauge, err := LookupGauge(api, "02")
+	is.Nil(err)
+	is.Nil(gauge.Set(13))
+	is.Eq(2, len(sender.calls))
+	is.Eq("POST metric/02/set value=13", sender.calls[1])
+	sender.calls = nil
+	// histogram
+	sender.responses = []fakeResponse{{data: []byte(`{"id":"03", "name":"Latency", "type": 2}`)}, {}, {}}
+	histogram, err := LookupHistogram(api, "03")
+	is.Nil(err)
+	is.Nil(histogram.Observe(5, 3, 5))
+	is.Nil(histogram.ObserveDuration(1500 * time.Millisecond))
+	is.Eq(3, len(sender.calls))
+	is.Eq("POST metric/03/values values=3%2C5%3A2", sender.calls[1])
+	is.Eq("POST metric/03/values values=1500", sender.calls[2])
+	sender.calls = nil
+	// wrong type
+	sender.responses = []fakeResponse{{data: []byte(`{"id":"02", "name":"Users", "type": 1}`)}}
+	_, err = LookupCounter(api, "02")
+	is.Eq(`wrong metric type: metric 02 "Users" is a gauge, not a counter`, err.Error())
+	is.True(errors.Is(err, ErrMetricType))
+	sender.calls = nil
+	// wrong id
+	sender.responses = []fakeResponse{{nil, errors.New("status 404")}}
+	_, err = LookupHistogram(api, "99")
+	is.Eq("status 404", err.Error())
+	// unchecked handle
+	sender.calls = nil
+	sender.responses = []fakeResponse{{}}
+	is.Nil(NewGauge(api, "04").Set(0))
+	is.Eq("POST metric/04/set value=0", sender.calls[0])
+}
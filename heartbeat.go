@@ -0,0 +1,81 @@
+package monibot
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HeartbeatOptions holds optional parameters for RunHeartbeatWithOptions.
+type HeartbeatOptions struct {
+
+	// Default is no logging.
+	Logger Logger
+
+	// The interval in which heartbeats are sent.
+	// Default is a third of the watchdog interval, so that
+	// one lost heartbeat does not trigger the watchdog.
+	Interval time.Duration
+
+	// Healthy, if not nil, is called before each heartbeat. If it
+	// returns an error, the heartbeat is not sent, so that the
+	// watchdog triggers if the service stays unhealthy.
+	Healthy func(ctx context.Context) error
+}
+
+// RunHeartbeat is like RunHeartbeatWithOptions with default options.
+func RunHeartbeat(ctx context.Context, api Client, watchdogId string) error {
+	return RunHeartbeatWithOptions(ctx, api, watchdogId, HeartbeatOptions{})
+}
+
+// RunHeartbeatWithOptions fetches a watchdog and sends heartbeats for
+// it at a fraction of the watchdog interval. It sends the first
+// heartbeat right away. It blocks until ctx is done and returns
+// ctx.Err(), so it is usually started in its own goroutine.
+// It returns an error if the watchdog cannot be fetched.
+func RunHeartbeatWithOptions(ctx context.Context, api Client, watchdogId string, options HeartbeatOptions) error {
+	return runHeartbeat(ctx, api, watchdogId, options, func(d time.Duration) (<-chan time.Time, func()) {
+		ticker := time.NewTicker(d)
+		return ticker.C, ticker.Stop
+	})
+}
+
+func runHeartbeat(ctx context.Context, api Client, watchdogId string, options HeartbeatOptions, newTicker func(time.Duration) (<-chan time.Time, func())) error {
+	logger := options.Logger
+	if logger == nil {
+		logger = zeroLogger{}
+	}
+	interval := options.Interval
+	if interval <= 0 {
+		watchdog, err := api.GetWatchdogWithContext(ctx, watchdogId)
+		if err != nil {
+			return fmt.Errorf("cannot get watchdog %s: %w", watchdogId, err)
+		}
+		interval = time.Duration(watchdog.IntervalMillis) * time.Millisecond / 3
+		if interval <= 0 {
+			return fmt.Errorf("watchdog %s has invalid interval %dms", watchdogId, watchdog.IntervalMillis)
+		}
+	}
+	logger.Debug("sending heartbeats for watchdog %s every %s", watchdogId, interval)
+	ticks, stop := newTicker(interval)
+	defer stop()
+	for {
+		healthy := true
+		if options.Healthy != nil {
+			if err := options.Healthy(ctx); err != nil {
+				logger.Debug("unhealthy, not sending heartbeat: %s", err)
+				healthy = false
+			}
+		}
+		if healthy {
+			if err := api.PostWatchdogHeartbeatWithContext(ctx, watchdogId); err != nil {
+				logger.Debug("cannot send heartbeat: %s", err)
+			}
+		}
+		select {
+		case <-ticks:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
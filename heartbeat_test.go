@@ -0,0 +1,72 @@
+package monibot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	is := assert.New(t)
+	sender := &chanSender{make(chan string), make(chan error)}
+	api := &Api{sender}
+	ticks := make(chan time.Time)
+	newTicker := func(d time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+	healthy := make(chan error)
+	options := HeartbeatOptions{
+		Interval: 10 * time.Second,
+		Healthy: func(ctx context.Context) error {
+			return <-healthy
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- runHeartbeat(ctx, api, "w1", options, newTicker)
+	}()
+	// first heartbeat is sent right away
+	healthy <- nil
+	is.Eq("POST watchdog/w1/heartbeat", <-sender.calls)
+	sender.release <- errors.New("status 500")
+	// no heartbeat if unhealthy
+	ticks <- time.Now()
+	healthy <- errors.New("database down")
+	ticks <- time.Now()
+	healthy <- nil
+	is.Eq("POST watchdog/w1/heartbeat", <-sender.calls)
+	sender.release <- nil
+	// cancel stops the loop
+	cancel()
+	is.Eq(context.Canceled, <-result)
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{}
+	api := &Api{sender}
+	// interval is a third of watchdog interval
+	sender.responses = []fakeResponse{{data: []byte(`{"id":"w1", "name":"Job", "intervalMillis": 90000}`)}, {}}
+	ctx, cancel := context.WithCancel(context.Background())
+	var interval time.Duration
+	newTicker := func(d time.Duration) (<-chan time.Time, func()) {
+		interval = d
+		cancel()
+		return nil, func() {}
+	}
+	err := runHeartbeat(ctx, api, "w1", HeartbeatOptions{}, newTicker)
+	is.Eq(context.Canceled, err)
+	is.Eq(30*time.Second, interval)
+	is.Eq(2, len(sender.calls))
+	is.Eq("GET watchdog/w1", sender.calls[0])
+	is.Eq("POST watchdog/w1/heartbeat", sender.calls[1])
+	sender.calls = nil
+	// watchdog not found
+	sender.responses = []fakeResponse{{nil, errors.New("status 404")}}
+	err = runHeartbeat(context.Background(), api, "w2", HeartbeatOptions{}, newTicker)
+	is.Eq("cannot get watchdog w2: status 404", err.Error())
+}
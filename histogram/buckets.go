@@ -0,0 +1,85 @@
+package histogram
+
+import "math/bits"
+
+// An Accumulator collects histogram values in log-linear buckets,
+// like an HDR histogram. Values below 2^(precision+1) are kept
+// exactly, larger values are rounded to the middle of a bucket,
+// so that the relative error is at most 2^-(precision+1), e.g.
+// 0.4% for precision 7.
+//
+// Use it for values that are nearly all distinct, e.g. latencies in
+// nanoseconds: only one value:count pair per bucket is uploaded.
+//
+// Values must be non-negative, negative values are added as 0.
+// The zero value is not usable, create one with NewAccumulator.
+// An Accumulator is not safe for concurrent use.
+type Accumulator struct {
+	precision int
+	values    Values // counts per bucket representative
+}
+
+// NewAccumulator creates an Accumulator with a precision in bits,
+// which is clamped to 0..62.
+func NewAccumulator(precision int) *Accumulator {
+	return &Accumulator{precision: min(max(precision, 0), 62)}
+}
+
+// Precision returns the precision in bits.
+func (a *Accumulator) Precision() int {
+	return a.precision
+}
+
+// Add adds a value.
+func (a *Accumulator) Add(v int64) {
+	a.AddN(v, 1)
+}
+
+// AddN adds a value n times. It does nothing if n < 1.
+// A negative value is added as 0.
+func (a *Accumulator) AddN(v int64, n int64) {
+	a.values.AddN(quantize(max(v, 0), a.precision), n)
+}
+
+// Merge adds all values of other. If other has a different
+// precision, its values are quantized again.
+func (a *Accumulator) Merge(other *Accumulator) {
+	for v, n := range other.values.All() {
+		a.AddN(v, n)
+	}
+}
+
+// Len returns the number of values.
+func (a *Accumulator) Len() int64 {
+	return a.values.Len()
+}
+
+// Values returns a copy of the bucket representatives and their
+// counts, e.g. for Api.PostMetricHistogram.
+func (a *Accumulator) Values() *Values {
+	var values Values
+	values.Merge(&a.values)
+	return &values
+}
+
+// String formats the bucket representatives and their counts
+// like StringifyValues, e.g. "1,2:3".
+func (a *Accumulator) String() string {
+	return a.values.String()
+}
+
+// Reset removes all values.
+func (a *Accumulator) Reset() {
+	a.values = Values{}
+}
+
+// quantize returns the representative of the bucket of v,
+// which must be non-negative.
+func quantize(v int64, precision int) int64 {
+	shift := bits.Len64(uint64(v)) - precision - 1
+	if shift <= 0 {
+		return v
+	}
+	lo := v >> shift << shift
+	return lo + 1<<(shift-1)
+}
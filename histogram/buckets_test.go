@@ -0,0 +1,74 @@
+package histogram
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestQuantize(t *testing.T) {
+	is := assert.New(t)
+	// precision 2: values < 8 are exact, buckets have 4 sub-buckets
+	for v := range int64(8) {
+		is.Eq(v, quantize(v, 2))
+	}
+	// 8..15 in buckets of width 2
+	is.Eq(int64(9), quantize(8, 2))
+	is.Eq(int64(9), quantize(9, 2))
+	is.Eq(int64(11), quantize(10, 2))
+	is.Eq(int64(15), quantize(15, 2))
+	// 16..31 in buckets of width 4
+	is.Eq(int64(18), quantize(16, 2))
+	is.Eq(int64(18), quantize(19, 2))
+	is.Eq(int64(30), quantize(31, 2))
+	is.Eq(int64(7<<60+1<<59), quantize(math.MaxInt64, 2))
+	is.Eq(int64(math.MaxInt64), quantize(math.MaxInt64, 62))
+}
+
+func TestAccumulator(t *testing.T) {
+	is := assert.New(t)
+	a := NewAccumulator(7)
+	is.Eq(7, a.Precision())
+	rng := rand.New(rand.NewPCG(1, 2))
+	var raw []int64
+	for range 100_000 {
+		v := int64(rng.ExpFloat64() * 20e6) // latencies around 20ms, in nanoseconds
+		raw = append(raw, v)
+		a.Add(v)
+	}
+	is.Eq(int64(100_000), a.Len())
+	// negative values are added as 0
+	neg := NewAccumulator(7)
+	neg.Add(-5)
+	neg.AddN(math.MinInt64, 2)
+	is.Eq("0:3", neg.String())
+	// relative error is bounded
+	maxErr := 0.0
+	for _, v := range raw {
+		if v > 0 {
+			maxErr = max(maxErr, math.Abs(float64(quantize(v, 7)-v))/float64(v))
+		}
+	}
+	is.True(maxErr <= 1.0/256)
+	// upload is orders of magnitude smaller
+	rawSize := len(StringifyValues(raw))
+	size := len(a.String())
+	is.True(size*20 < rawSize)
+	// string format can be parsed
+	values, err := ParseCompactValues(a.String())
+	is.Nil(err)
+	is.Eq(int64(100_000), values.Len())
+	is.Eq(a.Values().String(), values.String())
+	// merge
+	b := NewAccumulator(3)
+	b.Add(1000)
+	b.Merge(a)
+	is.Eq(int64(100_001), b.Len())
+	is.True(len(b.String()) < size)
+	// reset
+	a.Reset()
+	is.Eq(int64(0), a.Len())
+	is.Eq("", a.String())
+}
@@ -0,0 +1,186 @@
+package histogram
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Values is a compact histogram that stores each distinct value
+// together with its count, so that adding a value a million times
+// does not take more memory than adding it once.
+//
+// The zero value is an empty histogram ready to use.
+// Values is not safe for concurrent use.
+type Values struct {
+	counts map[int64]int64 // count per distinct value
+	n      int64           // total count
+	sorted []int64         // distinct values in ascending order, nil if outdated
+}
+
+// Add adds a value.
+func (h *Values) Add(v int64) {
+	h.AddN(v, 1)
+}
+
+// AddN adds a value n times. It does nothing if n < 1.
+func (h *Values) AddN(v int64, n int64) {
+	if n < 1 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make(map[int64]int64)
+	}
+	if _, found := h.counts[v]; !found {
+		h.sorted = nil
+	}
+	h.counts[v] += n
+	h.n += n
+}
+
+// Merge adds all values of other.
+func (h *Values) Merge(other *Values) {
+	for v, n := range other.All() {
+		h.AddN(v, n)
+	}
+}
+
+// Len returns the number of values, counting each value as often as it was added.
+func (h *Values) Len() int64 {
+	return h.n
+}
+
+// Min returns the smallest value, or 0 if h is empty.
+func (h *Values) Min() int64 {
+	keys := h.keys()
+	if len(keys) == 0 {
+		return 0
+	}
+	return keys[0]
+}
+
+// Max returns the largest value, or 0 if h is empty.
+func (h *Values) Max() int64 {
+	keys := h.keys()
+	if len(keys) == 0 {
+		return 0
+	}
+	return keys[len(keys)-1]
+}
+
+// Mean returns the arithmetic mean, or 0 if h is empty.
+func (h *Values) Mean() float64 {
+	if h.n == 0 {
+		return 0
+	}
+	var sum float64
+	for v, n := range h.counts {
+		sum += float64(v) * float64(n)
+	}
+	return sum / float64(h.n)
+}
+
+// Quantile returns the value at quantile q (0 <= q <= 1) using the
+// nearest-rank method, e.g. Quantile(0.99) is the 99th percentile.
+// It returns 0 if h is empty.
+func (h *Values) Quantile(q float64) int64 {
+	if h.n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.n)))
+	rank = min(max(rank, 1), h.n)
+	var seen int64
+	for v, n := range h.All() {
+		seen += n
+		if seen >= rank {
+			return v
+		}
+	}
+	return h.Max()
+}
+
+// All returns all distinct values and their counts in ascending order of value.
+func (h *Values) All() iter.Seq2[int64, int64] {
+	return func(yield func(int64, int64) bool) {
+		for _, v := range h.keys() {
+			if !yield(v, h.counts[v]) {
+				return
+			}
+		}
+	}
+}
+
+// String formats h like StringifyValues, e.g. "1,2:3".
+func (h *Values) String() string {
+	data, _ := h.AppendText(nil)
+	return string(data)
+}
+
+// AppendText appends the format of String to dst.
+func (h *Values) AppendText(dst []byte) ([]byte, error) {
+	first := true
+	for v, n := range h.All() {
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+		dst = strconv.AppendInt(dst, v, 10)
+		if n > 1 {
+			dst = append(dst, ':')
+			dst = strconv.AppendInt(dst, n, 10)
+		}
+	}
+	return dst, nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (h *Values) MarshalText() ([]byte, error) {
+	return h.AppendText(nil)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It replaces
+// the values of h with the parsed values.
+func (h *Values) UnmarshalText(text []byte) error {
+	parsed, err := ParseCompactValues(string(text))
+	if err != nil {
+		return err
+	}
+	*h = *parsed
+	return nil
+}
+
+// ParseCompactValues parses the format described in ParseValues
+// into Values, without expanding counts.
+func ParseCompactValues(s string) (*Values, error) {
+	h := &Values{}
+	if s == "" {
+		return h, nil
+	}
+	for itok := 1; ; itok++ {
+		tok, rest, more := strings.Cut(s, ",")
+		v, c, err := parseValueAndCount(tok)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse token #%d %q: %w", itok, tok, err)
+		}
+		h.AddN(v, int64(c))
+		if !more {
+			return h, nil
+		}
+		s = rest
+	}
+}
+
+// keys returns the distinct values in ascending order.
+func (h *Values) keys() []int64 {
+	if h.sorted == nil && len(h.counts) > 0 {
+		h.sorted = make([]int64, 0, len(h.counts))
+		for v := range h.counts {
+			h.sorted = append(h.sorted, v)
+		}
+		slices.Sort(h.sorted)
+	}
+	return h.sorted
+}
@@ -0,0 +1,68 @@
+package histogram
+
+import (
+	"testing"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestCompactValues(t *testing.T) {
+	is := assert.New(t)
+	var h Values
+	is.Eq(int64(0), h.Len())
+	is.Eq(int64(0), h.Min())
+	is.Eq(int64(0), h.Quantile(0.5))
+	is.Eq(0.0, h.Mean())
+	is.Eq("", h.String())
+	h.Add(3)
+	h.AddN(1, 2)
+	h.AddN(5, 0)
+	h.Add(3)
+	h.Add(10)
+	is.Eq("1:2,3:2,10", h.String())
+	is.Eq(int64(5), h.Len())
+	is.Eq(int64(1), h.Min())
+	is.Eq(int64(10), h.Max())
+	is.Eq(3.6, h.Mean())
+	is.Eq(int64(1), h.Quantile(0))
+	is.Eq(int64(1), h.Quantile(0.4))
+	is.Eq(int64(3), h.Quantile(0.5))
+	is.Eq(int64(3), h.Quantile(0.8))
+	is.Eq(int64(10), h.Quantile(0.81))
+	is.Eq(int64(10), h.Quantile(1))
+	// merge
+	var other Values
+	other.AddN(0, 4)
+	other.Add(3)
+	h.Merge(&other)
+	is.Eq("0:4,1:2,3:3,10", h.String())
+	is.Eq(int64(10), h.Len())
+	// marshal
+	data, err := h.MarshalText()
+	is.Nil(err)
+	var u Values
+	is.Nil(u.UnmarshalText(data))
+	is.Eq(h.String(), u.String())
+	is.Eq(int64(10), u.Len())
+}
+
+func TestParseCompactValues(t *testing.T) {
+	is := assert.New(t)
+	h, err := ParseCompactValues("")
+	is.Nil(err)
+	is.Eq(int64(0), h.Len())
+	h, err = ParseCompactValues("3:2,2:1,1,3:1")
+	is.Nil(err)
+	is.Eq("1,2,3:3", h.String())
+	// large counts are not expanded
+	h, err = ParseCompactValues("5:1000000000,7")
+	is.Nil(err)
+	is.Eq(int64(1000000001), h.Len())
+	is.Eq(int64(5), h.Quantile(0.99))
+	is.Eq("5:1000000000,7", h.String())
+	// errors
+	_, err = ParseCompactValues("1,-3:2")
+	is.Eq("cannot parse token #2 \"-3:2\": invalid value -3", err.Error())
+	_, err = ParseCompactValues("1,")
+	is.Eq("cannot parse token #2 \"\": cannot parse value \"\": strconv.ParseInt: parsing \"\": invalid syntax", err.Error())
+}
@@ -0,0 +1,184 @@
+package histogram
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxTokenSize limits the size of a "value:count" token. A valid
+// token has at most 19 digits, a colon and 19 digits, but we allow
+// some leading zeros.
+const maxTokenSize = 64
+
+// A SyntaxError is returned by a Decoder for an invalid token.
+type SyntaxError struct {
+	Token  int    // The token number, starting at 1.
+	Offset int64  // The byte offset of the token in the input.
+	Text   string // The token text, possibly truncated.
+	Err    error  // The reason.
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("cannot parse token #%d %q at offset %d: %s", e.Token, e.Text, e.Offset, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// An Encoder writes histogram values in the format described in
+// ParseValues to an io.Writer, one token at a time. Output is
+// buffered, call Flush when done.
+type Encoder struct {
+	w      *bufio.Writer
+	buf    []byte
+	tokens int
+	err    error
+}
+
+// NewEncoder creates an Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes a value with a count. The value must not be negative
+// and the count must be at least 1. Values need not be sorted or
+// distinct.
+func (e *Encoder) Encode(value, count int64) error {
+	if e.err != nil {
+		return e.err
+	}
+	if value < 0 {
+		return fmt.Errorf("invalid value %d", value)
+	}
+	if count < 1 {
+		return fmt.Errorf("invalid count %d", count)
+	}
+	e.buf = e.buf[:0]
+	if e.tokens > 0 {
+		e.buf = append(e.buf, ',')
+	}
+	e.buf = strconv.AppendInt(e.buf, value, 10)
+	if count > 1 {
+		e.buf = append(e.buf, ':')
+		e.buf = strconv.AppendInt(e.buf, count, 10)
+	}
+	_, e.err = e.w.Write(e.buf)
+	e.tokens++
+	return e.err
+}
+
+// EncodeValues writes all values of h.
+func (e *Encoder) EncodeValues(h *Values) error {
+	for v, n := range h.All() {
+		if err := e.Encode(v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes buffered output to the underlying io.Writer.
+func (e *Encoder) Flush() error {
+	if e.err != nil {
+		return e.err
+	}
+	e.err = e.w.Flush()
+	return e.err
+}
+
+// A Decoder reads histogram values in the format described in
+// ParseValues from an io.Reader, one token at a time, so that the
+// input never has to be held in memory. A single trailing newline
+// is ignored.
+type Decoder struct {
+	r      *bufio.Reader
+	buf    []byte
+	offset int64 // offset of the next byte
+	tokens int
+	eof    bool
+	err    error
+}
+
+// NewDecoder creates a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next token and returns its value and count.
+// It returns io.EOF if there are no more tokens, and a *SyntaxError
+// if a token is invalid. After an error, Decode returns the same error.
+func (d *Decoder) Decode() (int64, int64, error) {
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+	if d.eof {
+		return 0, 0, io.EOF
+	}
+	start := d.offset
+	token := d.tokens + 1
+	d.buf = d.buf[:0]
+	for {
+		b, err := d.r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			d.eof = true
+			break
+		}
+		if err != nil {
+			d.err = err
+			return 0, 0, err
+		}
+		d.offset++
+		if b == ',' {
+			break
+		}
+		if len(d.buf) >= maxTokenSize {
+			return 0, 0, d.syntaxError(token, start, fmt.Errorf("token too long"))
+		}
+		d.buf = append(d.buf, b)
+	}
+	if d.eof {
+		d.buf = trimNewline(d.buf)
+		if len(d.buf) == 0 && token == 1 {
+			return 0, 0, io.EOF
+		}
+	}
+	d.tokens = token
+	value, count, err := parseValueAndCount(string(d.buf))
+	if err != nil {
+		return 0, 0, d.syntaxError(token, start, err)
+	}
+	return value, int64(count), nil
+}
+
+// DecodeValues reads all remaining tokens into h.
+func (d *Decoder) DecodeValues(h *Values) error {
+	for {
+		value, count, err := d.Decode()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h.AddN(value, count)
+	}
+}
+
+func (d *Decoder) syntaxError(token int, offset int64, err error) error {
+	d.err = &SyntaxError{Token: token, Offset: offset, Text: string(d.buf), Err: err}
+	return d.err
+}
+
+func trimNewline(b []byte) []byte {
+	if n := len(b); n > 0 && b[n-1] == '\n' {
+		b = b[:n-1]
+		if n := len(b); n > 0 && b[n-1] == '\r' {
+			b = b[:n-1]
+		}
+	}
+	return b
+}
@@ -0,0 +1,99 @@
+package histogram
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	is := assert.New(t)
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	is.Nil(enc.Encode(3, 1))
+	is.Nil(enc.Encode(1, 1000000))
+	is.Eq("invalid value -1", enc.Encode(-1, 1).Error())
+	is.Eq("invalid count 0", enc.Encode(2, 0).Error())
+	var h Values
+	h.AddN(7, 2)
+	h.Add(5)
+	is.Nil(enc.EncodeValues(&h))
+	is.Eq("", buf.String())
+	is.Nil(enc.Flush())
+	is.Eq("3,1:1000000,5,7:2", buf.String())
+	// write errors are sticky
+	enc = NewEncoder(errWriter{})
+	is.Nil(enc.Encode(1, 1))
+	is.Eq("disk full", enc.Flush().Error())
+	is.Eq("disk full", enc.Encode(1, 1).Error())
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("disk full")
+}
+
+func TestDecoder(t *testing.T) {
+	decode := func(s string) string {
+		dec := NewDecoder(iotest.OneByteReader(strings.NewReader(s)))
+		var toks []string
+		for {
+			v, c, err := dec.Decode()
+			if errors.Is(err, io.EOF) {
+				return strings.Join(toks, " ")
+			}
+			if err != nil {
+				return strings.Join(append(toks, err.Error()), " ")
+			}
+			toks = append(toks, fmt.Sprintf("%d:%d", v, c))
+		}
+	}
+	is := assert.New(t)
+	is.Eq("", decode(""))
+	is.Eq("", decode("\n"))
+	is.Eq("1:1", decode("1"))
+	is.Eq("1:1 2:5000000000 1:3", decode("1,2:5000000000,1:3\r\n"))
+	is.Eq("1:1 cannot parse token #2 \"\" at offset 2: cannot parse value \"\": strconv.ParseInt: parsing \"\": invalid syntax", decode("1,"))
+	is.Eq("1:1 2:1 cannot parse token #3 \"-3:2\" at offset 4: invalid value -3", decode("1,2,-3:2,4"))
+	is.Eq("cannot parse token #1 \"1:0\" at offset 0: invalid count 0", decode("1:0"))
+	is.Eq("12:1 cannot parse token #2 \""+strings.Repeat("1", 64)+"\" at offset 3: token too long", decode("12,"+strings.Repeat("1", 100)))
+	// syntax errors are typed and sticky
+	dec := NewDecoder(strings.NewReader("1,x,2"))
+	_, _, err := dec.Decode()
+	is.Nil(err)
+	_, _, err = dec.Decode()
+	var syntaxErr *SyntaxError
+	is.True(errors.As(err, &syntaxErr))
+	is.Eq(2, syntaxErr.Token)
+	is.Eq(int64(2), syntaxErr.Offset)
+	_, _, err = dec.Decode()
+	is.Eq(syntaxErr, err)
+	// read errors
+	readErr := errors.New("connection reset")
+	dec = NewDecoder(io.MultiReader(strings.NewReader("1,2"), iotest.ErrReader(readErr)))
+	_, _, err = dec.Decode()
+	is.Nil(err)
+	_, _, err = dec.Decode()
+	is.Eq(readErr, err)
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	is := assert.New(t)
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for i := range int64(100_000) {
+		is.Nil(enc.Encode(i%1000, 1+i%3))
+	}
+	is.Nil(enc.Flush())
+	var h Values
+	is.Nil(NewDecoder(&buf).DecodeValues(&h))
+	is.Eq(int64(199_999), h.Len())
+	is.Eq(int64(999), h.Max())
+}
@@ -0,0 +1,247 @@
+package histogram
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+)
+
+// A Summary holds summary statistics of histogram values.
+// Percentiles use the nearest-rank method.
+type Summary struct {
+	Count  int64
+	Min    int64
+	Max    int64
+	Mean   float64
+	Stddev float64 // population standard deviation
+	P50    int64
+	P90    int64
+	P99    int64
+}
+
+// String formats s like "count=5 min=1 max=10 mean=3.6 stddev=3.2 p50=3 p90=10 p99=10".
+func (s Summary) String() string {
+	return fmt.Sprintf("count=%d min=%d max=%d mean=%.4g stddev=%.4g p50=%d p90=%d p99=%d",
+		s.Count, s.Min, s.Max, s.Mean, s.Stddev, s.P50, s.P90, s.P99)
+}
+
+// Summarize computes exact summary statistics of values,
+// e.g. of values returned by ParseValues.
+func Summarize(values []int64) Summary {
+	var h Values
+	for _, v := range values {
+		h.Add(v)
+	}
+	return h.Summary()
+}
+
+// Stddev returns the population standard deviation, or 0 if h is empty.
+func (h *Values) Stddev() float64 {
+	if h.n == 0 {
+		return 0
+	}
+	mean := h.Mean()
+	var sum float64
+	for v, n := range h.counts {
+		d := float64(v) - mean
+		sum += d * d * float64(n)
+	}
+	return math.Sqrt(sum / float64(h.n))
+}
+
+// Summary computes exact summary statistics of h.
+func (h *Values) Summary() Summary {
+	return Summary{
+		Count:  h.n,
+		Min:    h.Min(),
+		Max:    h.Max(),
+		Mean:   h.Mean(),
+		Stddev: h.Stddev(),
+		P50:    h.Quantile(0.5),
+		P90:    h.Quantile(0.9),
+		P99:    h.Quantile(0.99),
+	}
+}
+
+// A Sketch estimates quantiles of a stream of values in bounded
+// memory, like a DDSketch: each quantile it returns is within a
+// relative error of the exact quantile. Count, min, max, mean and
+// stddev are exact.
+//
+// Sketches with the same relative error can be merged, e.g. one
+// sketch per goroutine. A Sketch is safe for concurrent use.
+// Values should be non-negative, negative values are counted as 0
+// for quantiles.
+//
+// The zero value is an empty Sketch with a relative error of 1%.
+type Sketch struct {
+	mu       sync.Mutex
+	gamma    float64 // 0 until initialized
+	logGamma float64
+	buckets  map[int]int64 // bucket i holds values in (gamma^(i-1), gamma^i]
+	zeros    int64         // count of values <= 0
+	n        int64
+	min, max int64
+	mean     float64
+	m2       float64 // sum of squared differences from the mean
+}
+
+// defaultRelativeError is the relative error of a zero Sketch.
+const defaultRelativeError = 0.01
+
+// NewSketch creates a Sketch with a relative error, e.g. 0.01 for 1%.
+// The relative error is clamped to 0.0001..0.5.
+func NewSketch(relativeError float64) *Sketch {
+	s := &Sketch{}
+	s.init(relativeError)
+	return s
+}
+
+func (s *Sketch) init(relativeError float64) {
+	alpha := min(max(relativeError, 0.0001), 0.5)
+	s.gamma = (1 + alpha) / (1 - alpha)
+	s.logGamma = math.Log(s.gamma)
+	s.buckets = make(map[int]int64)
+}
+
+// initDefault initializes a zero Sketch. The caller must hold s.mu.
+func (s *Sketch) initDefault() {
+	if s.gamma == 0 {
+		s.init(defaultRelativeError)
+	}
+}
+
+// Add adds a value.
+func (s *Sketch) Add(v int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addN(v, 1)
+}
+
+func (s *Sketch) addN(v int64, n int64) {
+	s.initDefault()
+	if s.n == 0 {
+		s.min, s.max = v, v
+	} else {
+		s.min = min(s.min, v)
+		s.max = max(s.max, v)
+	}
+	// Welford's online algorithm, for n equal values
+	s.n += n
+	f := float64(v)
+	d := f - s.mean
+	s.mean += d * float64(n) / float64(s.n)
+	s.m2 += d * (f - s.mean) * float64(n)
+	if v <= 0 {
+		s.zeros += n
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(f)/s.logGamma))] += n
+}
+
+// Merge adds all values of other. Both sketches must have been
+// created with the same relative error.
+func (s *Sketch) Merge(other *Sketch) error {
+	// copy other first, so that two goroutines can merge
+	// two sketches into each other without deadlock
+	other.mu.Lock()
+	other.initDefault()
+	o := Sketch{
+		gamma:   other.gamma,
+		buckets: maps.Clone(other.buckets),
+		zeros:   other.zeros,
+		n:       other.n,
+		min:     other.min,
+		max:     other.max,
+		mean:    other.mean,
+		m2:      other.m2,
+	}
+	other.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initDefault()
+	if s.gamma != o.gamma {
+		return fmt.Errorf("cannot merge sketches with different relative errors")
+	}
+	if o.n == 0 {
+		return nil
+	}
+	if s.n == 0 {
+		s.min, s.max = o.min, o.max
+	} else {
+		s.min = min(s.min, o.min)
+		s.max = max(s.max, o.max)
+	}
+	// Chan's parallel algorithm
+	n := s.n + o.n
+	d := o.mean - s.mean
+	s.mean += d * float64(o.n) / float64(n)
+	s.m2 += o.m2 + d*d*float64(s.n)*float64(o.n)/float64(n)
+	s.n = n
+	s.zeros += o.zeros
+	for i, n := range o.buckets {
+		s.buckets[i] += n
+	}
+	return nil
+}
+
+// Len returns the number of values.
+func (s *Sketch) Len() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.n
+}
+
+// Quantile returns an estimate of the value at quantile q (0 <= q <= 1),
+// or 0 if s is empty.
+func (s *Sketch) Quantile(q float64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quantile(q)
+}
+
+func (s *Sketch) quantile(q float64) int64 {
+	if s.n == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(s.n)))
+	rank = min(max(rank, 1), s.n)
+	seen := s.zeros
+	if seen >= rank {
+		return max(s.min, 0)
+	}
+	keys := make([]int, 0, len(s.buckets))
+	for i := range s.buckets {
+		keys = append(keys, i)
+	}
+	slices.Sort(keys)
+	for _, i := range keys {
+		seen += s.buckets[i]
+		if seen >= rank {
+			v := int64(math.Round(2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)))
+			return min(max(v, s.min), s.max)
+		}
+	}
+	return s.max
+}
+
+// Summary returns summary statistics, with estimated percentiles.
+func (s *Sketch) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.n == 0 {
+		return Summary{}
+	}
+	return Summary{
+		Count:  s.n,
+		Min:    s.min,
+		Max:    s.max,
+		Mean:   s.mean,
+		Stddev: math.Sqrt(s.m2 / float64(s.n)),
+		P50:    s.quantile(0.5),
+		P90:    s.quantile(0.9),
+		P99:    s.quantile(0.99),
+	}
+}
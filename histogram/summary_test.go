@@ -0,0 +1,107 @@
+package histogram
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	is := assert.New(t)
+	is.Eq("count=0 min=0 max=0 mean=0 stddev=0 p50=0 p90=0 p99=0", Summarize(nil).String())
+	values := []int64{10, 1, 3, 1, 3}
+	s := Summarize(values)
+	is.Eq("count=5 min=1 max=10 mean=3.6 stddev=3.323 p50=3 p90=10 p99=10", s.String())
+	// slice and compact form give the same result
+	h, err := ParseCompactValues(StringifyValues(values))
+	is.Nil(err)
+	is.Eq(s, h.Summary())
+	// large counts
+	h, err = ParseCompactValues("1:98,100,1000")
+	is.Nil(err)
+	is.Eq("count=100 min=1 max=1000 mean=11.98 stddev=99.79 p50=1 p90=1 p99=100", h.Summary().String())
+}
+
+func TestSketch(t *testing.T) {
+	is := assert.New(t)
+	s := NewSketch(0.01)
+	is.Eq(Summary{}, s.Summary())
+	is.Eq(int64(0), s.Quantile(0.5))
+	rng := rand.New(rand.NewPCG(1, 2))
+	var exact Values
+	for range 100_000 {
+		v := int64(rng.ExpFloat64() * 20e6)
+		exact.Add(v)
+		s.Add(v)
+	}
+	s.Add(0)
+	exact.Add(0)
+	want := exact.Summary()
+	have := s.Summary()
+	is.Eq(want.Count, have.Count)
+	is.Eq(want.Min, have.Min)
+	is.Eq(want.Max, have.Max)
+	is.True(math.Abs(want.Mean-have.Mean) < 1e-6*want.Mean)
+	is.True(math.Abs(want.Stddev-have.Stddev) < 1e-6*want.Stddev)
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+		w, h := float64(exact.Quantile(q)), float64(s.Quantile(q))
+		is.True(math.Abs(w-h) <= 0.01*w+1)
+	}
+	// memory is bounded
+	is.True(len(s.buckets) < 2000)
+}
+
+func TestSketchMerge(t *testing.T) {
+	is := assert.New(t)
+	total := NewSketch(0.02)
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := NewSketch(0.02)
+			for v := range int64(1000) {
+				local.Add(int64(g)*1000 + v + 1)
+			}
+			is.Nil(total.Merge(local))
+		}()
+	}
+	wg.Wait()
+	s := total.Summary()
+	is.Eq(int64(4000), s.Count)
+	is.Eq(int64(1), s.Min)
+	is.Eq(int64(4000), s.Max)
+	is.Eq(2000.5, s.Mean)
+	is.True(math.Abs(float64(s.P50)-2000) <= 40)
+	is.True(math.Abs(float64(s.P99)-3960) <= 80)
+	is.True(total.Merge(NewSketch(0.01)) != nil)
+}
+
+func TestSketchZero(t *testing.T) {
+	is := assert.New(t)
+	var s Sketch
+	is.Eq(Summary{}, s.Summary())
+	is.Eq(int64(0), s.Quantile(0.5))
+	// values with a large offset, whose variance is lost
+	// if computed as mean of squares minus square of mean
+	for range 1000 {
+		for _, v := range []int64{1e12, 1e12 + 1, 1e12 + 2} {
+			s.Add(v)
+		}
+	}
+	have := s.Summary()
+	is.Eq(int64(3000), have.Count)
+	is.True(math.Abs(have.Mean-(1e12+1)) < 1e-2)
+	is.True(math.Abs(have.Stddev-math.Sqrt(2.0/3)) < 1e-4)
+	// zero sketches have a relative error of 1%
+	var other Sketch
+	other.Add(1e12 + 3)
+	is.Nil(s.Merge(&other))
+	is.Nil(s.Merge(NewSketch(0.01)))
+	is.True(s.Merge(NewSketch(0.02)) != nil)
+	is.Eq(int64(3001), s.Len())
+	is.Eq(int64(1e12+3), s.Summary().Max)
+}
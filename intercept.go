@@ -0,0 +1,30 @@
+package monibot
+
+import "github.com/cvilsmeier/monibot-go/internal/sending"
+
+// A Request is one trial of an API call, as seen by an Interceptor.
+// It holds the method, path, body and trial number, and additional
+// request headers that an Interceptor may set, e.g. for request signing.
+type Request = sending.Request
+
+// A Response is the response to one trial of an API call, as seen by
+// an Interceptor. It holds the status, headers, body and duration.
+type Response = sending.Response
+
+// A RoundTripFunc sends a Request and returns its Response, or an
+// error if no response was received.
+type RoundTripFunc = sending.RoundTripFunc
+
+// An Interceptor wraps each trial of an API call. It may inspect or
+// modify the request, must call next to send it, and may inspect the
+// response or error before returning them. It must not retain the
+// request body after returning, because the body may be reused.
+//
+//	func logCalls(ctx context.Context, req *monibot.Request, next monibot.RoundTripFunc) (*monibot.Response, error) {
+//		resp, err := next(ctx, req)
+//		if err == nil {
+//			log.Printf("%s %s trial %d: status %d in %s", req.Method, req.Path, req.Trial, resp.Status, resp.Duration)
+//		}
+//		return resp, err
+//	}
+type Interceptor = sending.Interceptor
@@ -0,0 +1,58 @@
+package monibot_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+	"github.com/cvilsmeier/monibot-go/monibottest"
+)
+
+func TestInterceptors(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 60_000})
+	srv.FailNext(1, 503, 0)
+	var calls []string
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl: srv.URL,
+		Delay:      time.Millisecond,
+		Interceptors: []monibot.Interceptor{
+			func(ctx context.Context, req *monibot.Request, next monibot.RoundTripFunc) (*monibot.Response, error) {
+				resp, err := next(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+				calls = append(calls, fmt.Sprintf("%s %s trial=%d status=%d", req.Method, req.Path, req.Trial, resp.Status))
+				return resp, err
+			},
+		},
+	})
+	is.Nil(api.PostWatchdogHeartbeat("w1"))
+	is.Eq(2, len(calls))
+	is.Eq("POST watchdog/w1/heartbeat trial=1 status=503", calls[0])
+	is.Eq("POST watchdog/w1/heartbeat trial=2 status=200", calls[1])
+}
+
+func TestRateLimit(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 60_000})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl: srv.URL,
+		RateLimit:  50,
+		RateBurst:  2,
+	})
+	start := time.Now()
+	for range 6 {
+		is.Nil(api.PostWatchdogHeartbeat("w1"))
+	}
+	// 2 at once, then 4 at 20ms intervals
+	is.True(time.Since(start) >= 75*time.Millisecond)
+	is.Eq(6, srv.Heartbeats("w1"))
+}
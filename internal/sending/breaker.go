@@ -0,0 +1,122 @@
+package sending
+
+import (
+	"sync"
+	"time"
+)
+
+// A BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Requests are sent.
+	BreakerOpen                         // Requests fail fast.
+	BreakerHalfOpen                     // One probe request is sent.
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// A Breaker is a circuit breaker that is safe for concurrent use.
+// After threshold consecutive failed trials it opens and rejects
+// all trials for coolDown. Then it lets one probe trial through
+// (half-open): if the probe succeeds, it closes, otherwise it
+// opens again. A nil *Breaker never opens.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	coolDown  time.Duration
+	now       func() time.Time
+	state     BreakerState
+	failures  int       // consecutive failures while closed
+	openedAt  time.Time // when the breaker opened
+	probing   bool      // true while the half-open probe is in flight
+}
+
+// NewBreaker creates a closed Breaker.
+func NewBreaker(threshold int, coolDown time.Duration, now func() time.Time) *Breaker {
+	return &Breaker{threshold: max(1, threshold), coolDown: coolDown, now: now}
+}
+
+// State returns the current state.
+func (b *Breaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.coolDown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a trial may be sent. If it returns true,
+// the caller must report the outcome of the trial with Record, or
+// call Release if the trial has no outcome, e.g. it was cancelled.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Record reports the outcome of a trial that was allowed.
+func (b *Breaker) Record(ok bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		b.failures = 0
+		b.probing = false
+	}
+}
+
+// Release reports that a trial that was allowed has no outcome,
+// e.g. because it was cancelled. It does not change the state, but
+// lets another probe through if the breaker is half-open.
+func (b *Breaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
@@ -0,0 +1,131 @@
+package sending
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	is := assert.New(t)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	b := NewBreaker(3, time.Minute, now)
+	is.Eq(BreakerClosed, b.State())
+	// successes reset the failure count
+	for _, ok := range []bool{false, false, true, false, false} {
+		is.True(b.Allow())
+		b.Record(ok)
+	}
+	is.Eq(BreakerClosed, b.State())
+	// third consecutive failure opens the breaker
+	is.True(b.Allow())
+	b.Record(false)
+	is.Eq(BreakerOpen, b.State())
+	is.Eq("open", b.State().String())
+	is.True(!b.Allow())
+	// after cool-down, one probe is allowed
+	clock = clock.Add(time.Minute)
+	is.Eq(BreakerHalfOpen, b.State())
+	is.True(b.Allow())
+	is.True(!b.Allow())
+	// failed probe opens again
+	b.Record(false)
+	is.Eq(BreakerOpen, b.State())
+	is.True(!b.Allow())
+	// successful probe closes
+	clock = clock.Add(time.Minute)
+	is.True(b.Allow())
+	b.Record(true)
+	is.Eq(BreakerClosed, b.State())
+	is.True(b.Allow())
+	// a released probe lets the next probe through
+	for range 3 {
+		is.True(b.Allow())
+		b.Record(false)
+	}
+	clock = clock.Add(time.Minute)
+	is.True(b.Allow())
+	is.True(!b.Allow())
+	b.Release()
+	is.Eq(BreakerHalfOpen, b.State())
+	is.True(b.Allow())
+	b.Record(true)
+	is.Eq(BreakerClosed, b.State())
+	// a nil breaker never opens
+	var nb *Breaker
+	is.True(nb.Allow())
+	nb.Record(false)
+	nb.Release()
+	is.Eq(BreakerClosed, nb.State())
+}
+
+func TestSenderBreaker(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(2, time.Minute, func() time.Time { return clock })
+	sender := NewSender(transport, logger, 5, ConstantRetry(time.Second), 0, nil, b, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{503, []byte("service unavailable"), nil, nil},
+		{503, []byte("service unavailable"), nil, nil},
+		{200, []byte("ok"), nil, nil},
+	}
+	// second failed trial opens the breaker and stops retrying
+	_, err := sender.Send(context.Background(), "POST", "metric/01/inc", []byte("value=1"))
+	is.Eq("status 503: service unavailable", err.Error())
+	is.Eq(2, len(transport.calls))
+	is.Eq(BreakerOpen, b.State())
+	// open breaker fails fast
+	_, err = sender.Send(context.Background(), "POST", "metric/01/inc", []byte("value=1"))
+	is.True(errors.Is(err, ErrCircuitOpen))
+	var apiErr *ApiError
+	is.True(errors.As(err, &apiErr))
+	is.Eq(0, apiErr.Trials)
+	is.Eq(2, len(transport.calls))
+	// probe after cool-down
+	clock = clock.Add(time.Minute)
+	data, err := sender.Send(context.Background(), "POST", "metric/01/inc", []byte("value=1"))
+	is.Nil(err)
+	is.Eq("ok", string(data))
+	is.Eq(3, len(transport.calls))
+	is.Eq(BreakerClosed, b.State())
+}
+
+func TestSenderBreakerCancelled(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		return make(chan time.Time) // never fires
+	}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	b := NewBreaker(2, time.Minute, now)
+	// the limiter has no tokens left, so each trial waits for it
+	limiter := NewLimiter(0.001, 1, now, timeAfter)
+	sender := NewSender(transport, logger, 3, ConstantRetry(time.Second), 0, []Interceptor{limiter.Intercept}, b, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{200, []byte("ok"), nil, nil},
+	}
+	_, err := sender.Send(context.Background(), "POST", "metric/01/inc", []byte("value=1"))
+	is.Nil(err)
+	// cancelled calls do not open the breaker
+	for range 5 {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = sender.Send(ctx, "POST", "metric/01/inc", []byte("value=1"))
+		is.True(errors.Is(err, context.Canceled))
+	}
+	is.Eq(1, len(transport.calls))
+	is.Eq(BreakerClosed, b.State())
+}
@@ -0,0 +1,57 @@
+package sending
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrNotFound         = errors.New("not found")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrRetriesExhausted = errors.New("retries exhausted")
+	ErrCircuitOpen      = errors.New("circuit breaker open")
+)
+
+// An ApiError is returned by Sender.Send if a request did not succeed.
+type ApiError struct {
+	Method string // The request method, e.g. "POST".
+	Path   string // The request path, e.g. "watchdog/00000001/heartbeat".
+	Status int    // The HTTP status code of the last trial, 0 if there was no response.
+	Body   string // The response body of the last trial.
+	Trials int    // The number of trials made.
+	Err    error  // The network error of the last trial, or ErrCircuitOpen, nil if there was a response.
+
+	exhausted bool // true if the sender gave up because it ran out of trials
+}
+
+func (e *ApiError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	msg := fmt.Sprintf("status %d", e.Status)
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+func (e *ApiError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e matches one of the sentinel errors
+// ErrUnauthorized, ErrNotFound, ErrRateLimited or ErrRetriesExhausted.
+func (e *ApiError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.Status == 401
+	case ErrNotFound:
+		return e.Status == 404
+	case ErrRateLimited:
+		return e.Status == 429
+	case ErrRetriesExhausted:
+		return e.exhausted
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package sending
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// A Request is one trial of an API request.
+type Request struct {
+	Method string      // The request method, e.g. "POST".
+	Path   string      // The request path, e.g. "watchdog/00000001/heartbeat".
+	Body   []byte      // The request body, may be empty.
+	Header http.Header // Additional request headers, e.g. for request signing.
+	Trial  int         // The trial number, starting at 1.
+}
+
+// A Response is the response to one trial of an API request.
+type Response struct {
+	Status   int           // The HTTP status code.
+	Header   http.Header   // The response headers.
+	Body     []byte        // The response body.
+	Duration time.Duration // The time it took to send the request and read the response.
+}
+
+// A RoundTripFunc sends a request and returns its response, or an
+// error if no response was received.
+type RoundTripFunc func(ctx context.Context, req *Request) (*Response, error)
+
+// An Interceptor wraps each trial of an API request. It may inspect
+// or modify the request, must call next to send it, and may inspect
+// the response or error before returning them. It must not retain
+// the request body after returning.
+type Interceptor func(ctx context.Context, req *Request, next RoundTripFunc) (*Response, error)
+
+// errNoResponse is returned for an interceptor that returned
+// neither a response nor an error.
+var errNoResponse = errors.New("interceptor returned no response")
+
+// chain wraps roundTrip with interceptors, the first interceptor
+// being the outermost one.
+func chain(roundTrip RoundTripFunc, interceptors []Interceptor) RoundTripFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], roundTrip
+		roundTrip = func(ctx context.Context, req *Request) (*Response, error) {
+			resp, err := interceptor(ctx, req, next)
+			if resp == nil && err == nil {
+				return nil, errNoResponse
+			}
+			return resp, err
+		}
+	}
+	return roundTrip
+}
@@ -0,0 +1,72 @@
+package sending
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestInterceptors(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	var log []string
+	outer := func(ctx context.Context, req *Request, next RoundTripFunc) (*Response, error) {
+		log = append(log, fmt.Sprintf("outer before %s %s trial=%d", req.Method, req.Path, req.Trial))
+		req.Header.Set("X-Signature", "sig-"+string(req.Body))
+		resp, err := next(ctx, req)
+		if err != nil {
+			log = append(log, fmt.Sprintf("outer after err=%s", err))
+		} else {
+			log = append(log, fmt.Sprintf("outer after status=%d body=%s", resp.Status, resp.Body))
+		}
+		return resp, err
+	}
+	inner := func(ctx context.Context, req *Request, next RoundTripFunc) (*Response, error) {
+		log = append(log, fmt.Sprintf("inner before signature=%s", req.Header.Get("X-Signature")))
+		return next(ctx, req)
+	}
+	sender := NewSender(transport, logger, 3, ConstantRetry(time.Second), 0, []Interceptor{outer, inner}, nil, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{0, nil, fmt.Errorf("connection refused"), nil},
+		{200, []byte("ok"), nil, nil},
+	}
+	data, err := sender.Send(context.Background(), "POST", "metric/01/inc", []byte("value=1"))
+	is.Nil(err)
+	is.Eq("ok", string(data))
+	is.Eq(6, len(log))
+	is.Eq("outer before POST metric/01/inc trial=1", log[0])
+	is.Eq("inner before signature=sig-value=1", log[1])
+	is.Eq("outer after err=connection refused", log[2])
+	is.Eq("outer before POST metric/01/inc trial=2", log[3])
+	is.Eq("inner before signature=sig-value=1", log[4])
+	is.Eq("outer after status=200 body=ok", log[5])
+	is.Eq("sig-value=1", transport.headers[1].Get("X-Signature"))
+}
+
+func TestInterceptorNoResponse(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	shortCircuit := func(ctx context.Context, req *Request, next RoundTripFunc) (*Response, error) {
+		return nil, nil
+	}
+	limiter := NewLimiter(100, 10, time.Now, timeAfter)
+	sender := NewSender(transport, logger, 1, ConstantRetry(time.Second), 0, []Interceptor{limiter.Intercept, shortCircuit}, nil, timeAfter)
+	_, err := sender.Send(context.Background(), "GET", "ping", nil)
+	is.Eq(errNoResponse.Error(), err.Error())
+	is.Eq(0, len(transport.calls))
+}
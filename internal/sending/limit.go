@@ -0,0 +1,106 @@
+package sending
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Limiter is a token-bucket rate limiter that is safe for
+// concurrent use. After a 429 response it halves its rate, and
+// after each other response it increases its rate again by a
+// sixteenth of the configured rate, up to the configured rate.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     float64 // configured rate in tokens per second
+	rate      float64 // current rate, lower than limit after 429 responses
+	burst     float64
+	tokens    float64
+	last      time.Time
+	now       func() time.Time
+	timeAfter TimeAfterFunc
+}
+
+// NewLimiter creates a Limiter that allows rate requests per second
+// with bursts of up to burst requests.
+func NewLimiter(rate float64, burst int, now func() time.Time, timeAfter TimeAfterFunc) *Limiter {
+	burst = max(1, burst)
+	return &Limiter{
+		limit:     rate,
+		rate:      rate,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		last:      now(),
+		now:       now,
+		timeAfter: timeAfter,
+	}
+}
+
+// Rate returns the current rate in requests per second.
+func (l *Limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait waits until a request is allowed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.refill()
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-l.timeAfter(wait):
+		return nil
+	case <-ctx.Done():
+		// give back the reserved token
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Adapt adjusts the rate to a response status.
+func (l *Limiter) Adapt(status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if status == 429 {
+		l.rate = max(l.rate/2, l.limit/64)
+		l.tokens = min(l.tokens, 0)
+	} else {
+		l.rate = min(l.rate+l.limit/16, l.limit)
+	}
+}
+
+// Intercept is an Interceptor that waits for the limiter before
+// each trial and adapts the limiter to each response.
+func (l *Limiter) Intercept(ctx context.Context, req *Request, next RoundTripFunc) (*Response, error) {
+	if err := l.Wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := next(ctx, req)
+	if err == nil {
+		l.Adapt(resp.Status)
+	}
+	return resp, err
+}
+
+// refill adds the tokens that accrued since the last refill.
+// The caller must hold l.mu.
+func (l *Limiter) refill() {
+	now := l.now()
+	elapsed := now.Sub(l.last)
+	l.last = now
+	if elapsed > 0 {
+		l.tokens = min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+	}
+}
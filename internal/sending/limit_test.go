@@ -0,0 +1,95 @@
+package sending
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	is := assert.New(t)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	var waits []time.Duration
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		clock = clock.Add(d)
+		c := make(chan time.Time, 1)
+		c <- clock
+		return c
+	}
+	ctx := context.Background()
+	l := NewLimiter(10, 2, now, timeAfter)
+	// burst
+	is.Nil(l.Wait(ctx))
+	is.Nil(l.Wait(ctx))
+	is.Eq(0, len(waits))
+	// then 10 per second
+	is.Nil(l.Wait(ctx))
+	is.Nil(l.Wait(ctx))
+	is.Eq(2, len(waits))
+	is.Eq(100*time.Millisecond, waits[0].Round(time.Millisecond))
+	is.Eq(100*time.Millisecond, waits[1].Round(time.Millisecond))
+	// idle time refills up to burst
+	clock = clock.Add(time.Minute)
+	is.Nil(l.Wait(ctx))
+	is.Nil(l.Wait(ctx))
+	is.Eq(2, len(waits))
+	// 429 halves the rate
+	l.Adapt(429)
+	is.Eq(5.0, l.Rate())
+	is.Nil(l.Wait(ctx))
+	is.Eq(3, len(waits))
+	is.Eq(200*time.Millisecond, waits[2].Round(time.Millisecond))
+	l.Adapt(429)
+	l.Adapt(429)
+	is.Eq(1.25, l.Rate())
+	// other responses increase the rate, up to the limit
+	l.Adapt(200)
+	is.Eq(1.875, l.Rate())
+	for range 20 {
+		l.Adapt(200)
+	}
+	is.Eq(10.0, l.Rate())
+}
+
+func TestLimiterContextDone(t *testing.T) {
+	is := assert.New(t)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		return make(chan time.Time) // never fires
+	}
+	l := NewLimiter(1, 1, now, timeAfter)
+	is.Nil(l.Wait(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	is.Eq(context.Canceled, l.Wait(ctx))
+	// the cancelled wait did not use up a token
+	clock = clock.Add(time.Second)
+	is.Nil(l.Wait(ctx))
+}
+
+func TestLimiterIntercept(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	l := NewLimiter(8, 1, time.Now, timeAfter)
+	sender := NewSender(transport, logger, 3, ConstantRetry(0), 0, []Interceptor{l.Intercept}, nil, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{429, []byte("too many requests"), nil, nil},
+		{200, []byte("ok"), nil, nil},
+	}
+	data, err := sender.Send(context.Background(), "POST", "metric/01/inc", []byte("value=1"))
+	is.Nil(err)
+	is.Eq("ok", string(data))
+	is.Eq(2, len(transport.calls))
+	is.Eq(4.5, l.Rate())
+}
@@ -0,0 +1,38 @@
+package sending
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// A Logger receives structured log records.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// debugLogger prints debug messages
+type debugLogger interface {
+	Debug(format string, args ...any)
+}
+
+// DebugLogger adapts a logger that prints debug messages. Records of
+// all levels are printed as debug messages like "retrying method=GET path=ping".
+func DebugLogger(logger debugLogger) Logger {
+	return textLogger{logger}
+}
+
+type textLogger struct {
+	logger debugLogger
+}
+
+func (l textLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for _, attr := range attrs {
+		attr.Value = attr.Value.Resolve()
+		sb.WriteByte(' ')
+		sb.WriteString(attr.String())
+	}
+	l.logger.Debug("%s", sb.String())
+}
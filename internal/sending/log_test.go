@@ -0,0 +1,65 @@
+package sending
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestDebugLogger(t *testing.T) {
+	is := assert.New(t)
+	debug := &fakeDebugLogger{}
+	logger := DebugLogger(debug)
+	logger.Log(context.Background(), slog.LevelWarn, "retrying", slog.String("method", "GET"), slog.Int("trial", 2))
+	is.Eq(1, len(debug.lines))
+	is.Eq("retrying method=GET trial=2", debug.lines[0])
+}
+
+func TestSenderLogLevels(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &recordingLogger{}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	sender := NewSender(transport, logger, 2, ConstantRetry(time.Second), 0, nil, nil, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{503, nil, nil, nil},
+		{503, []byte("maintenance"), nil, nil},
+	}
+	_, err := sender.Send(context.Background(), "GET", "ping", nil)
+	is.Eq("status 503: maintenance", err.Error())
+	is.Eq(4, len(logger.lines))
+	is.Eq("DEBUG trial method=GET path=ping trial=1 trials=2", logger.lines[0])
+	is.Eq("WARN retrying method=GET path=ping trial=1 status=503 error=status 503 delay_ms=1000", logger.lines[1])
+	is.Eq("DEBUG trial method=GET path=ping trial=2 trials=2", logger.lines[2])
+	is.Eq("ERROR request failed method=GET path=ping trial=2 status=503 error=status 503: maintenance", logger.lines[3])
+}
+
+// fakeDebugLogger is a debugLogger for unit tests
+type fakeDebugLogger struct {
+	lines []string
+}
+
+func (f *fakeDebugLogger) Debug(format string, args ...any) {
+	f.lines = append(f.lines, fmt.Sprintf(format, args...))
+}
+
+// recordingLogger is a Logger for unit tests
+type recordingLogger struct {
+	lines []string
+}
+
+func (r *recordingLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	line := level.String() + " " + msg
+	for _, attr := range attrs {
+		line += " " + attr.String()
+	}
+	r.lines = append(r.lines, line)
+}
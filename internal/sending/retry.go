@@ -0,0 +1,108 @@
+package sending
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A RetryPolicy computes the time to wait before the next trial.
+type RetryPolicy interface {
+
+	// Delay returns the time to wait after trial (1-based) has failed.
+	// The prev argument is the delay that was returned for the
+	// previous trial, or 0 if trial is 1.
+	Delay(trial int, prev time.Duration) time.Duration
+}
+
+// ConstantRetry waits the same delay before each trial.
+func ConstantRetry(delay time.Duration) RetryPolicy {
+	return constantRetry{max(delay, 0)}
+}
+
+type constantRetry struct {
+	delay time.Duration
+}
+
+func (r constantRetry) Delay(trial int, prev time.Duration) time.Duration {
+	return r.delay
+}
+
+// ExponentialRetry doubles the delay after each trial, starting
+// with base and never exceeding maxDelay.
+func ExponentialRetry(base, maxDelay time.Duration) RetryPolicy {
+	return exponentialRetry{max(base, 0), max(maxDelay, base, 0)}
+}
+
+type exponentialRetry struct {
+	base     time.Duration
+	maxDelay time.Duration
+}
+
+func (r exponentialRetry) Delay(trial int, prev time.Duration) time.Duration {
+	delay := r.base
+	for i := 1; i < trial && delay < r.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, r.maxDelay)
+}
+
+// DecorrelatedJitterRetry waits a random delay between base and
+// three times the previous delay, never exceeding maxDelay.
+// It keeps a fleet of clients from retrying in lockstep.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func DecorrelatedJitterRetry(base, maxDelay time.Duration) RetryPolicy {
+	return decorrelatedJitterRetry{max(base, 0), max(maxDelay, base, 0)}
+}
+
+type decorrelatedJitterRetry struct {
+	base     time.Duration
+	maxDelay time.Duration
+}
+
+func (r decorrelatedJitterRetry) Delay(trial int, prev time.Duration) time.Duration {
+	upper := max(prev*3, r.base)
+	delay := r.base
+	if upper > r.base {
+		delay += rand.N(upper - r.base)
+	}
+	return min(delay, r.maxDelay)
+}
+
+// maxServerDelay is the longest delay that a server can ask for
+// with a Retry-After or X-RateLimit-Reset header.
+const maxServerDelay = 5 * time.Minute
+
+// serverDelay returns the time the server asks us to wait before the
+// next request, taken from the Retry-After or X-RateLimit-* headers,
+// or 0 if the headers do not ask for a delay. The delay is capped at
+// maxServerDelay.
+func serverDelay(header http.Header, now time.Time) time.Duration {
+	return min(parseServerDelay(header, now), maxServerDelay)
+}
+
+func parseServerDelay(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	// Retry-After: <seconds> or Retry-After: <http-date>
+	if s := header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return max(time.Duration(secs)*time.Second, 0)
+		}
+		if t, err := http.ParseTime(s); err == nil {
+			return max(t.Sub(now), 0)
+		}
+	}
+	// X-RateLimit-Remaining: 0 and X-RateLimit-Reset: <seconds> or <unix-seconds>
+	if header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			if reset > 1_000_000_000 {
+				return max(time.Unix(reset, 0).Sub(now), 0)
+			}
+			return max(time.Duration(reset)*time.Second, 0)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package sending
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestRetryPolicies(t *testing.T) {
+	is := assert.New(t)
+	// constant
+	constant := ConstantRetry(5 * time.Second)
+	is.Eq(5*time.Second, constant.Delay(1, 0))
+	is.Eq(5*time.Second, constant.Delay(7, 5*time.Second))
+	// exponential
+	exponential := ExponentialRetry(time.Second, 10*time.Second)
+	is.Eq(1*time.Second, exponential.Delay(1, 0))
+	is.Eq(2*time.Second, exponential.Delay(2, 0))
+	is.Eq(4*time.Second, exponential.Delay(3, 0))
+	is.Eq(8*time.Second, exponential.Delay(4, 0))
+	is.Eq(10*time.Second, exponential.Delay(5, 0))
+	is.Eq(10*time.Second, exponential.Delay(100, 0))
+	// decorrelated jitter
+	jitter := DecorrelatedJitterRetry(time.Second, 10*time.Second)
+	is.Eq(time.Second, jitter.Delay(1, 0))
+	prev := time.Duration(0)
+	for trial := 1; trial < 100; trial++ {
+		d := jitter.Delay(trial, prev)
+		is.True(time.Second <= d)
+		is.True(d <= max(3*prev, time.Second))
+		is.True(d <= 10*time.Second)
+		prev = d
+	}
+}
+
+func TestServerDelay(t *testing.T) {
+	is := assert.New(t)
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	is.Eq(time.Duration(0), serverDelay(nil, now))
+	is.Eq(time.Duration(0), serverDelay(http.Header{}, now))
+	is.Eq(7*time.Second, serverDelay(http.Header{"Retry-After": {"7"}}, now))
+	is.Eq(time.Duration(0), serverDelay(http.Header{"Retry-After": {"-7"}}, now))
+	is.Eq(30*time.Second, serverDelay(http.Header{"Retry-After": {"Tue, 02 Jan 2024 10:00:30 GMT"}}, now))
+	is.Eq(time.Duration(0), serverDelay(http.Header{"Retry-After": {"Tue, 02 Jan 2024 09:00:00 GMT"}}, now))
+	is.Eq(time.Duration(0), serverDelay(http.Header{"Retry-After": {"soon"}}, now))
+	is.Eq(time.Duration(0), serverDelay(http.Header{"X-Ratelimit-Remaining": {"1"}, "X-Ratelimit-Reset": {"12"}}, now))
+	is.Eq(12*time.Second, serverDelay(http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"12"}}, now))
+	reset := now.Add(20 * time.Second).Unix()
+	header := http.Header{}
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+	is.Eq(20*time.Second, serverDelay(header, now))
+	// long delays are capped
+	is.Eq(maxServerDelay, serverDelay(http.Header{"Retry-After": {"86400"}}, now))
+	is.Eq(maxServerDelay, serverDelay(http.Header{"Retry-After": {"Wed, 03 Jan 2024 10:00:00 GMT"}}, now))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+	is.Eq(maxServerDelay, serverDelay(header, now))
+}
+
+func TestSenderRetryAfterAndMaxElapsed(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	var delays []time.Duration
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		delays = append(delays, d)
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	logger := &fakeLogger{t, false}
+	// must wait Retry-After if longer than policy delay
+	sender := NewSender(transport, logger, 3, ConstantRetry(2*time.Second), 0, nil, nil, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{429, nil, nil, http.Header{"Retry-After": {"10"}}},
+		{503, nil, nil, http.Header{"Retry-After": {"1"}}},
+		{200, []byte("ok"), nil, nil},
+	}
+	data, err := sender.Send(context.Background(), "GET", "ping", nil)
+	is.Nil(err)
+	is.Eq("ok", string(data))
+	is.Eq(2, len(delays))
+	is.Eq(10*time.Second, delays[0])
+	is.Eq(2*time.Second, delays[1])
+	transport.calls = nil
+	delays = nil
+	// must give up if max elapsed time would be exceeded
+	sender = NewSender(transport, logger, 12, ExponentialRetry(time.Second, time.Minute), 5*time.Second, nil, nil, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{500, nil, nil, nil},
+		{500, nil, nil, nil},
+		{500, nil, nil, nil},
+		{500, nil, nil, nil},
+	}
+	_, err = sender.Send(context.Background(), "GET", "ping", nil)
+	is.Eq("status 500", err.Error())
+	is.True(errors.Is(err, ErrRetriesExhausted))
+	is.Eq(3, len(transport.calls))
+	is.Eq(2, len(delays))
+	is.Eq(1*time.Second, delays[0])
+	is.Eq(2*time.Second, delays[1])
+}
@@ -2,67 +2,162 @@ package sending
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"time"
 )
 
-// logger prints debug messages
-type debugLogger interface {
-	Debug(format string, args ...any)
-}
-
 // TimeAfterFunc is the function type of time.After.
 type TimeAfterFunc func(time.Duration) <-chan time.Time
 
 type senderTransport interface {
-	Send(ctx context.Context, method, path string, body []byte) (int, []byte, error)
+	Send(ctx context.Context, method, path string, header http.Header, body []byte) (int, http.Header, []byte, error)
 }
 
 type Sender struct {
-	transport senderTransport
-	logger    debugLogger
-	trials    int
-	delay     time.Duration
-	timeAfter TimeAfterFunc
+	roundTrip  RoundTripFunc
+	logger     Logger
+	trials     int
+	policy     RetryPolicy
+	maxElapsed time.Duration
+	breaker    *Breaker
+	timeAfter  TimeAfterFunc
 }
 
-func NewSender(transport senderTransport, logger debugLogger, trials int, delay time.Duration, timeAfter TimeAfterFunc) *Sender {
+// NewSender creates a Sender that tries each request up to trials times,
+// waiting the delay given by policy between trials. If maxElapsed is > 0,
+// the sender does not start a trial that would begin later than maxElapsed
+// after the first one. Each trial is wrapped by interceptors, the first
+// interceptor being the outermost one. If breaker is not nil, trials are
+// not sent while it is open, and a request whose trial opens it is not
+// retried.
+func NewSender(transport senderTransport, logger Logger, trials int, policy RetryPolicy, maxElapsed time.Duration, interceptors []Interceptor, breaker *Breaker, timeAfter TimeAfterFunc) *Sender {
 	if trials < 1 {
 		trials = 1
 	}
-	if delay < 0 {
-		delay = 0
+	if policy == nil {
+		policy = ConstantRetry(0)
+	}
+	roundTrip := func(ctx context.Context, req *Request) (*Response, error) {
+		start := time.Now()
+		status, header, data, err := transport.Send(ctx, req.Method, req.Path, req.Header, req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{status, header, data, time.Since(start)}, nil
 	}
-	return &Sender{transport, logger, trials, delay, timeAfter}
+	return &Sender{chain(roundTrip, interceptors), logger, trials, policy, maxElapsed, breaker, timeAfter}
 }
 
+type singleTrialKey struct{}
+
+// WithSingleTrial returns a context that makes a Sender try a request
+// only once, e.g. for requests that are not idempotent.
+func WithSingleTrial(ctx context.Context) context.Context {
+	return context.WithValue(ctx, singleTrialKey{}, true)
+}
+
+// Send sends a request and returns the response body. It does not
+// retain body after it returned, so the caller may reuse it.
 func (s *Sender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	start := time.Now()
+	trials := s.trials
+	if ctx.Value(singleTrialKey{}) != nil {
+		trials = 1
+	}
 	var trial int
+	var delay, waited time.Duration
 	for {
 		trial++
-		s.logger.Debug("trial #%d/%d for %s %s", trial, s.trials, method, path)
-		status, data, err := s.transport.Send(ctx, method, path, body)
+		s.logger.Log(ctx, slog.LevelDebug, "trial",
+			slog.String("method", method),
+			slog.String("path", path),
+			slog.Int("trial", trial),
+			slog.Int("trials", trials),
+		)
+		if !s.breaker.Allow() {
+			apiErr := &ApiError{Method: method, Path: path, Trials: trial - 1, Err: ErrCircuitOpen}
+			s.logger.Log(ctx, slog.LevelError, "request failed", errorAttrs(apiErr)...)
+			return nil, apiErr
+		}
+		var status int
+		var header http.Header
+		var data []byte
+		resp, err := s.roundTrip(ctx, &Request{Method: method, Path: path, Body: body, Header: http.Header{}, Trial: trial})
+		if err == nil {
+			status, header, data = resp.Status, resp.Header, resp.Body
+		}
+		if ctx.Err() != nil {
+			// a cancelled trial says nothing about the server
+			s.breaker.Release()
+		} else {
+			s.breaker.Record(err == nil && status < 500)
+		}
 		done := isDone(status, err)
-		if done || trial >= s.trials {
-			if err == nil && status != 200 {
-				msg := fmt.Sprintf("status %d", status)
-				if len(data) > 0 {
-					msg += ": " + string(data)
-				}
-				err = errors.New(msg)
+		tripped := !done && s.breaker.State() == BreakerOpen
+		last := done || tripped || trial >= trials
+		if !last {
+			delay = max(s.policy.Delay(trial, delay), serverDelay(header, time.Now()))
+			if s.maxElapsed > 0 && max(time.Since(start), waited)+delay > s.maxElapsed {
+				s.logger.Log(ctx, slog.LevelDebug, "max elapsed time reached",
+					slog.String("method", method),
+					slog.String("path", path),
+					slog.Int64("max_elapsed_ms", s.maxElapsed.Milliseconds()),
+				)
+				last = true
 			}
-			return data, err
 		}
+		if last && err == nil && status == 200 {
+			return data, nil
+		}
+		apiErr := &ApiError{
+			Method:    method,
+			Path:      path,
+			Status:    status,
+			Body:      string(data),
+			Trials:    trial,
+			Err:       err,
+			exhausted: last && !done && !tripped,
+		}
+		if last {
+			s.logger.Log(ctx, slog.LevelError, "request failed", errorAttrs(apiErr)...)
+			return data, apiErr
+		}
+		if ctx.Err() != nil {
+			s.logger.Log(ctx, slog.LevelError, "request cancelled", errorAttrs(apiErr)...)
+			return nil, contextError(ctx, apiErr)
+		}
+		s.logger.Log(ctx, slog.LevelWarn, "retrying", append(errorAttrs(apiErr), slog.Int64("delay_ms", delay.Milliseconds()))...)
 		select {
-		case <-s.timeAfter(s.delay):
+		case <-s.timeAfter(delay):
 			// retry now
+			waited += delay
 		case <-ctx.Done():
-			return nil, fmt.Errorf("cancelled")
+			s.logger.Log(ctx, slog.LevelError, "request cancelled", errorAttrs(apiErr)...)
+			return nil, contextError(ctx, apiErr)
 		}
 	}
 }
 
+// errorAttrs returns log attributes for a failed trial.
+func errorAttrs(e *ApiError) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", e.Method),
+		slog.String("path", e.Path),
+		slog.Int("trial", e.Trials),
+		slog.Int("status", e.Status),
+	}
+	return append(attrs, slog.String("error", e.Error()))
+}
+
+// contextError wraps the error of a done context and the error of the
+// last trial, so that callers can use errors.Is(err, context.DeadlineExceeded)
+// as well as errors.As(err, &apiErr).
+func contextError(ctx context.Context, lastErr error) error {
+	return fmt.Errorf("%w (last trial: %w)", ctx.Err(), lastErr)
+}
+
 func isDone(status int, err error) bool {
 	if err != nil {
 		// newtwork error, e.g. connect failed
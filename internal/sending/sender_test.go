@@ -2,7 +2,10 @@ package sending
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"testing"
 	"time"
 
@@ -19,12 +22,12 @@ func TestRetrySender(t *testing.T) {
 	}
 	trials := 3
 	delay := 2 * time.Second
-	sender := NewSender(transport, logger, trials, delay, timeAfter)
+	sender := NewSender(transport, logger, trials, ConstantRetry(delay), 0, nil, nil, timeAfter)
 	// must retry if network error
 	transport.responses = []fakeTransportResponse{
-		{0, nil, fmt.Errorf("connection refused")},
-		{0, nil, fmt.Errorf("connection refused")},
-		{200, []byte("{\"ok\":true}"), nil},
+		{0, nil, fmt.Errorf("connection refused"), nil},
+		{0, nil, fmt.Errorf("connection refused"), nil},
+		{200, []byte("{\"ok\":true}"), nil, nil},
 	}
 	go func() {
 		timeChan <- time.Now()
@@ -40,9 +43,9 @@ func TestRetrySender(t *testing.T) {
 	transport.calls = nil
 	// must retry max trials
 	transport.responses = []fakeTransportResponse{
-		{0, nil, fmt.Errorf("connection error 1")},
-		{0, nil, fmt.Errorf("connection error 2")},
-		{0, nil, fmt.Errorf("connection error 3")},
+		{0, nil, fmt.Errorf("connection error 1"), nil},
+		{0, nil, fmt.Errorf("connection error 2"), nil},
+		{0, nil, fmt.Errorf("connection error 3"), nil},
 	}
 	go func() {
 		timeChan <- time.Now()
@@ -54,12 +57,21 @@ func TestRetrySender(t *testing.T) {
 	is.Eq("GET /ping", transport.calls[1])
 	is.Eq("GET /ping", transport.calls[2])
 	is.Eq("connection error 3", err.Error())
+	var apiErr *ApiError
+	is.True(errors.As(err, &apiErr))
+	is.Eq("GET", apiErr.Method)
+	is.Eq("/ping", apiErr.Path)
+	is.Eq(0, apiErr.Status)
+	is.Eq(3, apiErr.Trials)
+	is.Eq("connection error 3", apiErr.Err.Error())
+	is.True(errors.Is(err, ErrRetriesExhausted))
+	is.True(!errors.Is(err, ErrUnauthorized))
 	transport.calls = nil
 	// must retry if status 502 (bad gateway)
 	transport.responses = []fakeTransportResponse{
-		{502, nil, nil},
-		{502, nil, nil},
-		{200, []byte("{\"ok\":true}"), nil},
+		{502, nil, nil, nil},
+		{502, nil, nil, nil},
+		{200, []byte("{\"ok\":true}"), nil, nil},
 	}
 	go func() {
 		timeChan <- time.Now()
@@ -75,48 +87,75 @@ func TestRetrySender(t *testing.T) {
 	transport.calls = nil
 	// must not retry if authorization error
 	transport.responses = []fakeTransportResponse{
-		{401, []byte("401 - Unauthorized (invalid apiKey)"), nil},
+		{401, []byte("401 - Unauthorized (invalid apiKey)"), nil, nil},
 	}
 	_, err = sender.Send(context.Background(), "GET", "/ping", nil)
 	is.Eq(1, len(transport.calls))
 	is.Eq("GET /ping", transport.calls[0])
 	is.Eq("status 401: 401 - Unauthorized (invalid apiKey)", err.Error())
+	is.True(errors.As(err, &apiErr))
+	is.Eq(401, apiErr.Status)
+	is.Eq("401 - Unauthorized (invalid apiKey)", apiErr.Body)
+	is.Eq(1, apiErr.Trials)
+	is.Nil(apiErr.Err)
+	is.True(errors.Is(err, ErrUnauthorized))
+	is.True(!errors.Is(err, ErrRetriesExhausted))
 	transport.calls = nil
 	// must not retry if 404 (not found) but give error
 	transport.responses = []fakeTransportResponse{
-		{404, nil, nil},
+		{404, nil, nil, nil},
 	}
 	_, err = sender.Send(context.Background(), "GET", "/wrongUrl", nil)
 	is.Eq(1, len(transport.calls))
 	is.Eq("GET /wrongUrl", transport.calls[0])
 	is.Eq("status 404", err.Error())
+	is.True(errors.Is(err, ErrNotFound))
+	transport.calls = nil
+	// must give up after max trials if rate limited
+	transport.responses = []fakeTransportResponse{
+		{429, nil, nil, nil},
+		{429, nil, nil, nil},
+		{429, []byte("too many requests"), nil, nil},
+	}
+	go func() {
+		timeChan <- time.Now()
+		timeChan <- time.Now()
+	}()
+	_, err = sender.Send(context.Background(), "POST", "/inc", nil)
+	is.Eq(3, len(transport.calls))
+	is.Eq("status 429: too many requests", err.Error())
+	is.True(errors.Is(err, ErrRateLimited))
+	is.True(errors.Is(err, ErrRetriesExhausted))
 	transport.calls = nil
 }
 
 // fakeTransport is a Transport for unit tests
 type fakeTransport struct {
 	calls     []string
+	headers   []http.Header
 	responses []fakeTransportResponse
 }
 
-func (f *fakeTransport) Send(ctx context.Context, method, path string, body []byte) (int, []byte, error) {
+func (f *fakeTransport) Send(ctx context.Context, method, path string, header http.Header, body []byte) (int, http.Header, []byte, error) {
 	call := fmt.Sprintf("%s %s", method, path)
 	if len(body) > 0 {
 		call += fmt.Sprintf(" %s", string(body))
 	}
 	f.calls = append(f.calls, call)
+	f.headers = append(f.headers, header)
 	if len(f.responses) == 0 {
-		return 0, nil, fmt.Errorf("fakeSender is out of responses for request %s %s", method, path)
+		return 0, nil, nil, fmt.Errorf("fakeSender is out of responses for request %s %s", method, path)
 	}
 	re := f.responses[0]
 	f.responses = f.responses[1:]
-	return re.status, re.data, re.err
+	return re.status, re.header, re.data, re.err
 }
 
 type fakeTransportResponse struct {
 	status int
 	data   []byte
 	err    error
+	header http.Header
 }
 
 // fakeLogger is a Logger for unit tests
@@ -125,8 +164,67 @@ type fakeLogger struct {
 	enabled bool
 }
 
-func (f *fakeLogger) Debug(format string, args ...any) {
+func (f *fakeLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
 	if f.enabled {
-		f.t.Logf(format, args...)
+		f.t.Logf("%s %s %v", level, msg, attrs)
+	}
+}
+
+func TestSenderSingleTrial(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+	sender := NewSender(transport, logger, 3, ConstantRetry(time.Second), 0, nil, nil, timeAfter)
+	transport.responses = []fakeTransportResponse{
+		{503, []byte("service unavailable"), nil, nil},
+		{200, []byte("ok"), nil, nil},
+	}
+	_, err := sender.Send(WithSingleTrial(context.Background()), "POST", "machines", []byte("name=web1"))
+	is.Eq("status 503: service unavailable", err.Error())
+	is.True(errors.Is(err, ErrRetriesExhausted))
+	is.Eq(1, len(transport.calls))
+}
+
+func TestSenderContextDone(t *testing.T) {
+	is := assert.New(t)
+	transport := &fakeTransport{}
+	logger := &fakeLogger{t, false}
+	timeAfter := func(d time.Duration) <-chan time.Time {
+		return make(chan time.Time) // never fires
+	}
+	sender := NewSender(transport, logger, 3, ConstantRetry(time.Hour), 0, nil, nil, timeAfter)
+	// deadline exceeded while waiting for next trial
+	transport.responses = []fakeTransportResponse{
+		{500, []byte("internal error"), nil, nil},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := sender.Send(ctx, "GET", "ping", nil)
+	is.Eq("context deadline exceeded (last trial: status 500: internal error)", err.Error())
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.True(!errors.Is(err, context.Canceled))
+	is.True(!errors.Is(err, ErrRetriesExhausted))
+	var apiErr *ApiError
+	is.True(errors.As(err, &apiErr))
+	is.Eq(500, apiErr.Status)
+	is.Eq(1, apiErr.Trials)
+	is.Eq(1, len(transport.calls))
+	transport.calls = nil
+	// cancelled before first trial returns
+	transport.responses = []fakeTransportResponse{
+		{0, nil, fmt.Errorf("connection refused"), nil},
 	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = sender.Send(ctx, "GET", "ping", nil)
+	is.Eq("context canceled (last trial: connection refused)", err.Error())
+	is.True(errors.Is(err, context.Canceled))
+	is.True(errors.As(err, &apiErr))
+	is.Eq("connection refused", apiErr.Err.Error())
+	is.Eq(1, len(transport.calls))
 }
@@ -3,33 +3,78 @@ package sending
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// NewHttpClient creates a http.Client that uses a clone of
+// http.DefaultTransport with the given connect and
+// response-header timeouts.
+func NewHttpClient(connectTimeout, responseHeaderTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	return &http.Client{Transport: transport}
+}
+
 type Transport struct {
-	logger    debugLogger
+	logger    Logger
+	client    *http.Client
+	timeout   time.Duration
 	apiUrl    string
 	apiKey    string
 	userAgent string
 }
 
-func NewTransport(logger debugLogger, monibotUrl, apiKey, userAgent string) *Transport {
-	return &Transport{logger, monibotUrl + "/api/", apiKey, userAgent}
+// NewTransport creates a Transport that sends requests with client.
+// If timeout is > 0, each request is aborted after that duration.
+func NewTransport(logger Logger, client *http.Client, timeout time.Duration, monibotUrl, apiKey, userAgent string) *Transport {
+	return &Transport{logger, client, timeout, monibotUrl + "/api/", apiKey, userAgent}
 }
 
-func (s *Transport) Send(ctx context.Context, method, path string, body []byte) (int, []byte, error) {
+func (s *Transport) Send(ctx context.Context, method, path string, header http.Header, body []byte) (int, http.Header, []byte, error) {
 	urlpath := s.apiUrl + path
-	s.logger.Debug("%s %s", method, urlpath)
+	s.logger.Log(ctx, slog.LevelDebug, "request",
+		slog.String("method", method),
+		slog.String("path", path),
+		slog.Int("bytes", len(body)),
+		slog.Any("body", bodyValue{body, 0}),
+	)
+	start := time.Now()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	// the http.Client may read the body after Do returned, but the
+	// caller may reuse it after Send returned, so reads are stopped
+	guard := &bodyGuard{}
+	defer guard.stop()
+	var bodyReader io.Reader
 	if len(body) > 0 {
-		s.logger.Debug("body=%s", string(body))
+		bodyReader = guard.reader(body)
 	}
-	bodyReader := bytes.NewReader(body)
 	req, err := http.NewRequestWithContext(ctx, method, urlpath, bodyReader)
 	if err != nil {
-		s.logger.Debug("cannot create request: %s", err)
-		return 0, nil, err
+		s.logger.Log(ctx, slog.LevelDebug, "cannot create request", slog.String("error", err.Error()))
+		return 0, nil, nil, err
+	}
+	if len(body) > 0 {
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return guard.reader(body), nil
+		}
+	}
+	for key, values := range header {
+		req.Header[key] = values
 	}
 	if len(body) > 0 {
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -37,20 +82,82 @@ func (s *Transport) Send(ctx context.Context, method, path string, body []byte)
 	req.Header.Set("User-Agent", s.userAgent)
 	req.Header.Set("Authorization", "Bearer "+s.apiKey)
 	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		s.logger.Debug("%s %s: %s", req.Method, urlpath, err)
-		return 0, nil, err
+		s.logger.Log(ctx, slog.LevelDebug, "request error",
+			slog.String("method", method),
+			slog.String("path", path),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			slog.String("error", err.Error()),
+		)
+		return 0, nil, nil, err
 	}
 	defer resp.Body.Close()
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, nil, fmt.Errorf("cannot read response data: %w", err)
+		return 0, nil, nil, fmt.Errorf("cannot read response data: %w", err)
 	}
-	responseText := string(data)
-	if len(data) > 256 {
-		responseText = responseText[:256] + "..."
+	s.logger.Log(ctx, slog.LevelDebug, "response",
+		slog.String("method", method),
+		slog.String("path", path),
+		slog.Int("status", resp.StatusCode),
+		slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+		slog.Int("bytes", len(data)),
+		slog.Any("body", bodyValue{data, 256}),
+	)
+	return resp.StatusCode, resp.Header, data, nil
+}
+
+// A bodyValue formats a request or response body when it is
+// logged, so that bodies are not copied for loggers that discard them.
+// If max is > 0, bodies longer than max bytes are truncated.
+type bodyValue struct {
+	body []byte
+	max  int
+}
+
+func (v bodyValue) LogValue() slog.Value {
+	if v.max > 0 && len(v.body) > v.max {
+		return slog.StringValue(string(v.body[:v.max]) + "...")
+	}
+	return slog.StringValue(string(v.body))
+}
+
+// errBodyStopped is returned when a request body is read after
+// Transport.Send returned.
+var errBodyStopped = errors.New("request body read after send returned")
+
+// A bodyGuard stops reads of request bodies when it is stopped.
+type bodyGuard struct {
+	mu      sync.Mutex
+	stopped bool
+}
+
+// reader returns a reader for body that fails after g is stopped.
+func (g *bodyGuard) reader(body []byte) io.ReadCloser {
+	return &guardedReader{g, bytes.NewReader(body)}
+}
+
+func (g *bodyGuard) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stopped = true
+}
+
+type guardedReader struct {
+	guard *bodyGuard
+	r     *bytes.Reader
+}
+
+func (r *guardedReader) Read(p []byte) (int, error) {
+	r.guard.mu.Lock()
+	defer r.guard.mu.Unlock()
+	if r.guard.stopped {
+		return 0, errBodyStopped
 	}
-	s.logger.Debug("%d (%d bytes) %s", resp.StatusCode, len(data), responseText)
-	return resp.StatusCode, data, nil
+	return r.r.Read(p)
+}
+
+func (r *guardedReader) Close() error {
+	return nil
 }
@@ -3,9 +3,12 @@ package sending
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cvilsmeier/monibot-go/internal/assert"
 )
@@ -24,19 +27,108 @@ func TestSender(t *testing.T) {
 	defer server.Close()
 	// init
 	logger := &fakeSenderLogger{}
-	sender := NewTransport(logger, server.URL, "api-key-123", "0.2.3")
+	sender := NewTransport(logger, http.DefaultClient, 0, server.URL, "api-key-123", "0.2.3")
 	// send ok
-	status, data, err := sender.Send(context.Background(), "GET", "/ok", nil)
+	status, _, data, err := sender.Send(context.Background(), "GET", "/ok", nil, nil)
 	is.Nil(err)
 	is.Eq(200, status)
 	is.Eq("ok", string(data))
 	// send 500
-	status, data, err = sender.Send(context.Background(), "POST", "/500", nil)
+	status, _, data, err = sender.Send(context.Background(), "POST", "/500", nil, nil)
 	is.Nil(err)
 	is.Eq(500, status)
 	is.Eq("", string(data))
 }
 
+func TestTransportClientAndTimeout(t *testing.T) {
+	is := assert.New(t)
+	// setup fake api http server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/ok", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "ok")
+	})
+	mux.HandleFunc("/api/header", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", r.Header.Get("X-Signature"))
+	})
+	mux.HandleFunc("/api/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// custom client must be used
+	rt := &countingRoundTripper{next: http.DefaultTransport}
+	client := &http.Client{Transport: rt}
+	transport := NewTransport(&fakeSenderLogger{}, client, 50*time.Millisecond, server.URL, "api-key-123", "0.2.3")
+	status, _, data, err := transport.Send(context.Background(), "GET", "ok", nil, nil)
+	is.Nil(err)
+	is.Eq(200, status)
+	is.Eq("ok", string(data))
+	is.Eq(1, rt.count)
+	// additional headers must be sent
+	_, _, data, err = transport.Send(context.Background(), "GET", "header", http.Header{"X-Signature": {"abc"}}, nil)
+	is.Nil(err)
+	is.Eq("abc", string(data))
+	// slow response must time out
+	_, _, _, err = transport.Send(context.Background(), "GET", "slow", nil, nil)
+	is.True(err != nil)
+	is.Eq(3, rt.count)
+	// default client must time out waiting for response headers
+	client = NewHttpClient(time.Second, 50*time.Millisecond)
+	transport = NewTransport(&fakeSenderLogger{}, client, 0, server.URL, "api-key-123", "0.2.3")
+	_, _, _, err = transport.Send(context.Background(), "GET", "slow", nil, nil)
+	is.True(err != nil)
+}
+
+type countingRoundTripper struct {
+	next  http.RoundTripper
+	count int
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.count++
+	return c.next.RoundTrip(req)
+}
+
+func TestTransportLogBody(t *testing.T) {
+	is := assert.New(t)
+	// setup fake api http server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/long", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 300))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// bodies are formatted when logged, long responses are truncated
+	debug := &fakeDebugLogger{}
+	transport := NewTransport(DebugLogger(debug), http.DefaultClient, 0, server.URL, "api-key-123", "0.2.3")
+	_, _, _, err := transport.Send(context.Background(), "POST", "long", nil, []byte("value=1"))
+	is.Nil(err)
+	is.Eq(2, len(debug.lines))
+	is.Eq("request method=POST path=long bytes=7 body=value=1", debug.lines[0])
+	is.True(strings.HasSuffix(debug.lines[1], " bytes=300 body="+strings.Repeat("x", 256)+"..."))
+}
+
 type fakeSenderLogger struct{}
 
-func (f *fakeSenderLogger) Debug(format string, args ...any) {}
+func (f *fakeSenderLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+}
+
+func TestBodyGuard(t *testing.T) {
+	is := assert.New(t)
+	guard := &bodyGuard{}
+	r := guard.reader([]byte("value=42"))
+	p := make([]byte, 5)
+	n, err := r.Read(p)
+	is.Nil(err)
+	is.Eq("value", string(p[:n]))
+	is.Nil(r.Close())
+	// reads after stop fail, even for readers created before
+	guard.stop()
+	_, err = r.Read(p)
+	is.Eq(errBodyStopped, err)
+	_, err = guard.reader([]byte("value=42")).Read(p)
+	is.Eq(errBodyStopped, err)
+}
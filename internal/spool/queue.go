@@ -0,0 +1,441 @@
+// Package spool provides a persistent first-in-first-out queue that
+// is stored in a directory of append-only segment files.
+//
+// Each record is stored as a 4-byte length, a 4-byte CRC-32 checksum
+// and a JSON payload. The position of the first unacknowledged record
+// is stored in a file named "ack", which is replaced atomically.
+// After a crash, a partially written record at the end of the last
+// segment is detected by its length or checksum and cut off.
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Record is a queued API request.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Body   []byte    `json:"body"`
+}
+
+const headerSize = 8 // 4 bytes length, 4 bytes crc32
+
+// maxRecordSize protects against allocating huge buffers for corrupt lengths.
+const maxRecordSize = 16 << 20
+
+// errCorrupt is returned by readRecord for a record with an invalid
+// length, checksum or payload, as opposed to an I/O error.
+var errCorrupt = errors.New("corrupt record")
+
+// A Queue is a persistent queue of records. It is not safe
+// for concurrent use.
+type Queue struct {
+	dir          string
+	maxBytes     int64
+	maxAge       time.Duration
+	segmentBytes int64
+	segments     []segment // sorted by seq, the last one is the write segment
+	file         *os.File  // write segment, opened for appending
+	reader       *os.File  // segments[0], opened for reading, nil if not yet opened
+	readOffset   int64     // offset of first unacknowledged record in segments[0]
+	peekOffset   int64     // offset after the record returned by Peek, -1 if none
+	dropped      int
+}
+
+type segment struct {
+	seq  int
+	size int64
+}
+
+// Open opens the queue in dir, creating dir if needed, and recovers
+// from an earlier crash. If maxBytes is > 0, the oldest segments
+// are deleted if the queue grows larger than maxBytes. If maxAge is
+// > 0, records older than maxAge are skipped.
+func Open(dir string, maxBytes int64, maxAge time.Duration, segmentBytes int64) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, maxBytes: maxBytes, maxAge: maxAge, segmentBytes: segmentBytes, peekOffset: -1}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".seg")
+		if !found {
+			continue
+		}
+		seq, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, segment{seq, info.Size()})
+	}
+	slices.SortFunc(q.segments, func(a, b segment) int { return a.seq - b.seq })
+	if len(q.segments) == 0 {
+		q.segments = append(q.segments, segment{1, 0})
+	}
+	// find the first unacknowledged record
+	ackSeq, ackOffset, err := q.readAck()
+	if err != nil {
+		return nil, err
+	}
+	for len(q.segments) > 1 && q.segments[0].seq < ackSeq {
+		if err := os.Remove(q.segmentPath(q.segments[0].seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		q.segments = q.segments[1:]
+	}
+	if q.segments[0].seq == ackSeq {
+		q.readOffset = ackOffset
+	}
+	// cut off a partially written record at the end of the write segment
+	last := &q.segments[len(q.segments)-1]
+	valid, err := q.validSize(last.seq)
+	if err != nil {
+		return nil, err
+	}
+	q.file, err = os.OpenFile(q.segmentPath(last.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if valid < last.size {
+		if err := q.file.Truncate(valid); err != nil {
+			q.file.Close()
+			return nil, err
+		}
+	}
+	last.size = valid
+	q.readOffset = min(q.readOffset, q.segments[0].size)
+	if err := syncDir(dir); err != nil {
+		q.file.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Close closes the queue.
+func (q *Queue) Close() error {
+	q.closeReader()
+	return q.file.Close()
+}
+
+// Dropped returns the number of records that were dropped because
+// the queue grew larger than maxBytes, the records were older than
+// maxAge, or the records were corrupt. A corrupt length skips the rest
+// of its segment, which is counted as one record.
+func (q *Queue) Dropped() int {
+	return q.dropped
+}
+
+// Size returns the size of all segment files in bytes.
+func (q *Queue) Size() int64 {
+	var size int64
+	for _, seg := range q.segments {
+		size += seg.size
+	}
+	return size
+}
+
+// Append appends a record to the queue and syncs it to disk.
+func (q *Queue) Append(rec Record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxRecordSize {
+		return fmt.Errorf("record size %d exceeds maximum %d", len(payload), maxRecordSize)
+	}
+	last := &q.segments[len(q.segments)-1]
+	if q.segmentBytes > 0 && last.size > 0 && last.size+headerSize+int64(len(payload)) > q.segmentBytes {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		last = &q.segments[len(q.segments)-1]
+	}
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[headerSize:], payload)
+	if _, err := q.file.Write(buf); err != nil {
+		return err
+	}
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+	last.size += int64(len(buf))
+	return q.enforceMaxBytes()
+}
+
+// Peek returns the oldest unacknowledged record. It returns false if
+// the queue is empty. Records older than maxAge and corrupt records
+// are skipped, I/O errors are returned.
+func (q *Queue) Peek() (Record, bool, error) {
+	for {
+		seg := q.segments[0]
+		if q.readOffset >= seg.size {
+			if len(q.segments) == 1 {
+				return Record{}, false, nil
+			}
+			if err := q.removeFirst(); err != nil {
+				return Record{}, false, err
+			}
+			continue
+		}
+		if q.reader == nil {
+			f, err := os.Open(q.segmentPath(seg.seq))
+			if err != nil {
+				return Record{}, false, err
+			}
+			q.reader = f
+		}
+		rec, next, err := readRecord(q.reader, q.readOffset)
+		if errors.Is(err, errCorrupt) {
+			// skip the record, or the rest of the segment if its length is corrupt
+			q.dropped++
+			q.readOffset = seg.size
+			if next > 0 {
+				q.readOffset = next
+			}
+			if err := q.writeAck(); err != nil {
+				return Record{}, false, err
+			}
+			continue
+		}
+		if err != nil {
+			return Record{}, false, err
+		}
+		if q.maxAge > 0 && time.Since(rec.Time) > q.maxAge {
+			q.dropped++
+			q.readOffset = next
+			if err := q.writeAck(); err != nil {
+				return Record{}, false, err
+			}
+			continue
+		}
+		q.peekOffset = next
+		return rec, true, nil
+	}
+}
+
+// Ack removes the record returned by the last call to Peek.
+func (q *Queue) Ack() error {
+	if q.peekOffset < 0 {
+		return fmt.Errorf("no record to ack")
+	}
+	q.readOffset = q.peekOffset
+	q.peekOffset = -1
+	if q.readOffset >= q.segments[0].size && len(q.segments) > 1 {
+		return q.removeFirst()
+	}
+	return q.writeAck()
+}
+
+func (q *Queue) rotate() error {
+	if err := q.file.Close(); err != nil {
+		return err
+	}
+	seq := q.segments[len(q.segments)-1].seq + 1
+	file, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	q.file = file
+	q.segments = append(q.segments, segment{seq, 0})
+	return syncDir(q.dir)
+}
+
+func (q *Queue) enforceMaxBytes() error {
+	for q.maxBytes > 0 && q.Size() > q.maxBytes && len(q.segments) > 1 {
+		n, err := q.countRecords(q.segments[0].seq, q.readOffset)
+		if err != nil {
+			return err
+		}
+		q.dropped += n
+		if err := q.removeFirst(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFirst deletes the oldest segment, which must not be the write segment.
+func (q *Queue) removeFirst() error {
+	q.closeReader()
+	q.peekOffset = -1
+	q.readOffset = 0
+	seq := q.segments[0].seq
+	q.segments = q.segments[1:]
+	if err := q.writeAck(); err != nil {
+		return err
+	}
+	return os.Remove(q.segmentPath(seq))
+}
+
+func (q *Queue) closeReader() {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+}
+
+// countRecords counts the valid records in a segment starting at offset.
+func (q *Queue) countRecords(seq int, offset int64) (int, error) {
+	f, err := os.Open(q.segmentPath(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var n int
+	for {
+		_, next, err := readRecord(f, offset)
+		if errors.Is(err, io.EOF) || errors.Is(err, errCorrupt) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+		offset = next
+	}
+}
+
+// validSize returns the size of the valid records in a segment.
+func (q *Queue) validSize(seq int) (int64, error) {
+	f, err := os.Open(q.segmentPath(seq))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var offset int64
+	for {
+		_, next, err := readRecord(f, offset)
+		if errors.Is(err, io.EOF) || errors.Is(err, errCorrupt) {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset = next
+	}
+}
+
+// readRecord reads the record at offset and returns it and the offset
+// of the next record. It returns io.EOF if offset is the end of f.
+// For a record that is cut off or has a corrupt length, it returns
+// errCorrupt and 0. For a record with a corrupt checksum or payload,
+// it returns errCorrupt and the offset of the next record.
+func readRecord(f *os.File, offset int64) (Record, int64, error) {
+	var header [headerSize]byte
+	n, err := f.ReadAt(header[:], offset)
+	if err == io.EOF {
+		if n == 0 {
+			return Record{}, 0, io.EOF
+		}
+		return Record{}, 0, fmt.Errorf("%w: header cut off", errCorrupt)
+	}
+	if err != nil {
+		return Record{}, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return Record{}, 0, fmt.Errorf("%w: invalid size %d", errCorrupt, size)
+	}
+	payload := make([]byte, size)
+	if _, err := f.ReadAt(payload, offset+headerSize); err == io.EOF {
+		return Record{}, 0, fmt.Errorf("%w: payload cut off", errCorrupt)
+	} else if err != nil {
+		return Record{}, 0, err
+	}
+	next := offset + headerSize + int64(size)
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return Record{}, next, fmt.Errorf("%w: checksum mismatch", errCorrupt)
+	}
+	var rec Record
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return Record{}, next, fmt.Errorf("%w: %w", errCorrupt, err)
+	}
+	return rec, next, nil
+}
+
+// readAck reads the position of the first unacknowledged record.
+func (q *Queue) readAck() (int, int64, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, "ack"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var seq int
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &offset); err != nil {
+		return 0, 0, fmt.Errorf("cannot parse ack file: %w", err)
+	}
+	return seq, offset, nil
+}
+
+// writeAck atomically replaces the ack file.
+func (q *Queue) writeAck() error {
+	tmp := filepath.Join(q.dir, "ack.tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d %d\n", q.segments[0].seq, q.readOffset)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, "ack")); err != nil {
+		return err
+	}
+	return syncDir(q.dir)
+}
+
+// syncDir syncs a directory, so that created and renamed files
+// survive a crash. Windows does not support syncing directories.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (q *Queue) segmentPath(seq int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016d.seg", seq))
+}
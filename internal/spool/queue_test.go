@@ -0,0 +1,179 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestQueue(t *testing.T) {
+	is := assert.New(t)
+	dir := t.TempDir()
+	q, err := Open(dir, 0, 0, 100)
+	is.Nil(err)
+	// empty
+	_, ok, err := q.Peek()
+	is.Nil(err)
+	is.True(!ok)
+	// append and peek in order, rotating segments
+	for _, body := range []string{"value=1", "value=2", "value=3"} {
+		is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte(body)}))
+	}
+	is.Eq(3, len(q.segments))
+	rec, ok, err := q.Peek()
+	is.Nil(err)
+	is.True(ok)
+	is.Eq("POST metric/01/inc value=1", rec.Method+" "+rec.Path+" "+string(rec.Body))
+	// peek without ack returns same record
+	rec, _, _ = q.Peek()
+	is.Eq("value=1", string(rec.Body))
+	is.Nil(q.Ack())
+	is.Eq(2, len(q.segments))
+	// reopen keeps unacknowledged records
+	is.Nil(q.Close())
+	q, err = Open(dir, 0, 0, 100)
+	is.Nil(err)
+	rec, ok, _ = q.Peek()
+	is.True(ok)
+	is.Eq("value=2", string(rec.Body))
+	is.Nil(q.Ack())
+	rec, ok, _ = q.Peek()
+	is.True(ok)
+	is.Eq("value=3", string(rec.Body))
+	is.Nil(q.Ack())
+	_, ok, _ = q.Peek()
+	is.True(!ok)
+	is.Nil(q.Close())
+}
+
+func TestQueueRecovery(t *testing.T) {
+	is := assert.New(t)
+	dir := t.TempDir()
+	q, err := Open(dir, 0, 0, 0)
+	is.Nil(err)
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=1")}))
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=2")}))
+	is.Nil(q.Close())
+	// simulate a crash while writing the second record
+	path := filepath.Join(dir, "0000000000000001.seg")
+	info, err := os.Stat(path)
+	is.Nil(err)
+	is.Nil(os.Truncate(path, info.Size()-3))
+	q, err = Open(dir, 0, 0, 0)
+	is.Nil(err)
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=3")}))
+	rec, ok, _ := q.Peek()
+	is.True(ok)
+	is.Eq("value=1", string(rec.Body))
+	is.Nil(q.Ack())
+	rec, ok, _ = q.Peek()
+	is.True(ok)
+	is.Eq("value=3", string(rec.Body))
+	is.Nil(q.Ack())
+	_, ok, _ = q.Peek()
+	is.True(!ok)
+	is.Nil(q.Close())
+	// a record with a wrong checksum is cut off
+	q, err = Open(dir, 0, 0, 0)
+	is.Nil(err)
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=4")}))
+	is.Nil(q.Close())
+	data, err := os.ReadFile(path)
+	is.Nil(err)
+	data[len(data)-2] ^= 0xff
+	is.Nil(os.WriteFile(path, data, 0o644))
+	q, err = Open(dir, 0, 0, 0)
+	is.Nil(err)
+	_, ok, _ = q.Peek()
+	is.True(!ok)
+	is.Nil(q.Close())
+}
+
+func TestQueueLimits(t *testing.T) {
+	is := assert.New(t)
+	// records larger than maxRecordSize are rejected
+	{
+		dir := t.TempDir()
+		q, err := Open(dir, 0, 0, 0)
+		is.Nil(err)
+		err = q.Append(Record{time.Now(), "POST", "metric/01/values", make([]byte, maxRecordSize)})
+		is.True(err != nil)
+		is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=1")}))
+		is.Nil(q.Close())
+		q, err = Open(dir, 0, 0, 0)
+		is.Nil(err)
+		rec, ok, _ := q.Peek()
+		is.True(ok)
+		is.Eq("value=1", string(rec.Body))
+		is.Nil(q.Close())
+	}
+	// max bytes drops oldest segments
+	q, err := Open(t.TempDir(), 250, 0, 100)
+	is.Nil(err)
+	for _, body := range []string{"value=1", "value=2", "value=3", "value=4", "value=5"} {
+		is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte(body)}))
+	}
+	is.True(q.Size() <= 250)
+	is.Eq(3, q.Dropped())
+	rec, ok, _ := q.Peek()
+	is.True(ok)
+	is.Eq("value=4", string(rec.Body))
+	is.Nil(q.Close())
+	// max age skips old records
+	q, err = Open(t.TempDir(), 0, time.Hour, 0)
+	is.Nil(err)
+	is.Nil(q.Append(Record{time.Now().Add(-2 * time.Hour), "POST", "metric/01/inc", []byte("value=1")}))
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=2")}))
+	rec, ok, _ = q.Peek()
+	is.True(ok)
+	is.Eq("value=2", string(rec.Body))
+	is.Eq(1, q.Dropped())
+	is.Nil(q.Close())
+}
+
+func TestQueueCorruption(t *testing.T) {
+	is := assert.New(t)
+	dir := t.TempDir()
+	q, err := Open(dir, 0, 0, 0)
+	is.Nil(err)
+	for _, body := range []string{"value=1", "value=2", "value=3"} {
+		is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte(body)}))
+	}
+	is.Nil(q.Close())
+	// segment 1 holds three records, segments 2 and 3 hold one each
+	q, err = Open(dir, 0, 0, 1)
+	is.Nil(err)
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=4")}))
+	is.Nil(q.Append(Record{time.Now(), "POST", "metric/01/inc", []byte("value=5")}))
+	is.Eq(3, len(q.segments))
+	is.Nil(q.Close())
+	// a wrong checksum skips the first record
+	path := filepath.Join(dir, "0000000000000001.seg")
+	data, err := os.ReadFile(path)
+	is.Nil(err)
+	data[headerSize+2] ^= 0xff
+	// a wrong length of the second record skips the rest of the segment
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	data[headerSize+size] = 0xff
+	is.Nil(os.WriteFile(path, data, 0o644))
+	// an I/O error is returned
+	path = filepath.Join(dir, "0000000000000002.seg")
+	is.Nil(os.Remove(path))
+	is.Nil(os.Mkdir(path, 0o755))
+	q, err = Open(dir, 0, 0, 1)
+	is.Nil(err)
+	_, _, err = q.Peek()
+	is.True(err != nil)
+	is.Eq(2, q.Dropped())
+	// the I/O error does not skip records
+	_, _, err = q.Peek()
+	is.True(err != nil)
+	is.Eq(2, q.Dropped())
+	ack, err := os.ReadFile(filepath.Join(dir, "ack"))
+	is.Nil(err)
+	is.Eq("2 0\n", string(ack))
+	is.Nil(q.Close())
+}
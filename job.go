@@ -0,0 +1,87 @@
+package monibot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JobOptions holds optional parameters for RunJobWithOptions.
+type JobOptions struct {
+
+	// Default is no logging.
+	Logger Logger
+
+	// FailureCounterId, if not empty, is the id of a counter
+	// metric that is incremented each time the job fails.
+	FailureCounterId string
+
+	// MachineId, if not empty, is the id of a machine to which
+	// the error text is posted each time the job fails.
+	MachineId string
+
+	// DurationHistogramId, if not empty, is the id of a histogram
+	// metric that receives the job duration in milliseconds.
+	DurationHistogramId string
+}
+
+// RunJob is like RunJobWithOptions with default options.
+func RunJob(ctx context.Context, api Client, watchdogId string, job func(ctx context.Context) error) error {
+	return RunJobWithOptions(ctx, api, watchdogId, job, JobOptions{})
+}
+
+// RunJobWithOptions runs a job and sends a watchdog heartbeat if the
+// job returns nil. A panic in the job is recovered and treated as
+// a job failure. If the job fails, the failure counter is incremented
+// and the error text is posted, if configured.
+//
+// The API calls are not cancelled together with ctx, so that a job
+// that failed because ctx timed out is still reported. They are
+// cancelled after 2m instead.
+//
+// It returns the job error, joined with the errors of all API calls
+// that did not succeed.
+func RunJobWithOptions(ctx context.Context, api Client, watchdogId string, job func(ctx context.Context) error, options JobOptions) error {
+	logger := options.Logger
+	if logger == nil {
+		logger = zeroLogger{}
+	}
+	start := time.Now()
+	jobErr := runJob(ctx, job)
+	duration := time.Since(start)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jobReportTimeout)
+	defer cancel()
+	errs := []error{jobErr}
+	if options.DurationHistogramId != "" {
+		errs = append(errs, api.PostMetricValuesWithContext(ctx, options.DurationHistogramId, []int64{duration.Milliseconds()}))
+	}
+	if jobErr == nil {
+		logger.Debug("job %s succeeded after %s", watchdogId, duration)
+		errs = append(errs, api.PostWatchdogHeartbeatWithContext(ctx, watchdogId))
+		return errors.Join(errs...)
+	}
+	logger.Debug("job %s failed after %s: %s", watchdogId, duration, jobErr)
+	if options.FailureCounterId != "" {
+		errs = append(errs, api.PostMetricIncWithContext(ctx, options.FailureCounterId, 1))
+	}
+	if options.MachineId != "" {
+		text := fmt.Sprintf("job %s failed after %s: %s", watchdogId, duration.Round(time.Millisecond), jobErr)
+		errs = append(errs, api.PostMachineTextWithContext(ctx, options.MachineId, text))
+	}
+	return errors.Join(errs...)
+}
+
+// jobReportTimeout is the maximum time RunJobWithOptions spends
+// on reporting the outcome of a job.
+const jobReportTimeout = 2 * time.Minute
+
+// runJob runs a job and converts a panic into an error.
+func runJob(ctx context.Context, job func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job(ctx)
+}
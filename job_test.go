@@ -0,0 +1,104 @@
+package monibot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestRunJob(t *testing.T) {
+	is := assert.New(t)
+	sender := &fakeSender{}
+	api := &Api{sender}
+	options := JobOptions{
+		FailureCounterId:    "c1",
+		MachineId:           "m1",
+		DurationHistogramId: "h1",
+	}
+	// success sends heartbeat
+	sender.responses = []fakeResponse{{}}
+	err := RunJob(context.Background(), api, "w1", func(ctx context.Context) error {
+		return nil
+	})
+	is.Nil(err)
+	is.Eq(1, len(sender.calls))
+	is.Eq("POST watchdog/w1/heartbeat", sender.calls[0])
+	sender.calls = nil
+	// success with options records duration
+	sender.responses = []fakeResponse{{}, {}}
+	err = RunJobWithOptions(context.Background(), api, "w1", func(ctx context.Context) error {
+		return nil
+	}, options)
+	is.Nil(err)
+	is.Eq(2, len(sender.calls))
+	is.Eq("POST metric/h1/values values=0", sender.calls[0])
+	is.Eq("POST watchdog/w1/heartbeat", sender.calls[1])
+	sender.calls = nil
+	// failure increments counter and posts text, but sends no heartbeat
+	jobErr := errors.New("disk full")
+	sender.responses = []fakeResponse{{}, {}, {}}
+	err = RunJobWithOptions(context.Background(), api, "w1", func(ctx context.Context) error {
+		return jobErr
+	}, options)
+	is.True(errors.Is(err, jobErr))
+	is.Eq("disk full", err.Error())
+	is.Eq(3, len(sender.calls))
+	is.Eq("POST metric/h1/values values=0", sender.calls[0])
+	is.Eq("POST metric/c1/inc value=1", sender.calls[1])
+	is.Eq("POST machine/m1/text text=job+w1+failed+after+0s%3A+disk+full", sender.calls[2])
+	sender.calls = nil
+	// panic is a failure
+	sender.responses = []fakeResponse{{nil, errors.New("connect timeout")}}
+	err = RunJob(context.Background(), api, "w1", func(ctx context.Context) error {
+		panic("boom")
+	})
+	is.Eq("job panicked: boom", err.Error())
+	is.Eq(0, len(sender.calls))
+	// heartbeat error is returned
+	err = RunJob(context.Background(), api, "w1", func(ctx context.Context) error {
+		return nil
+	})
+	is.Eq("connect timeout", err.Error())
+	is.True(strings.HasPrefix(sender.calls[0], "POST watchdog/w1/heartbeat"))
+}
+
+func TestRunJobContextDone(t *testing.T) {
+	is := assert.New(t)
+	sender := &ctxSender{fakeSender{}}
+	api := &Api{sender}
+	options := JobOptions{
+		FailureCounterId:    "c1",
+		MachineId:           "m1",
+		DurationHistogramId: "h1",
+	}
+	// a job that timed out is still reported
+	sender.responses = []fakeResponse{{}, {}, {}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	err := RunJobWithOptions(ctx, api, "w1", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, options)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.Eq("context deadline exceeded", err.Error())
+	is.Eq(3, len(sender.calls))
+	is.True(strings.HasPrefix(sender.calls[0], "POST metric/h1/values"))
+	is.Eq("POST metric/c1/inc value=1", sender.calls[1])
+	is.True(strings.HasSuffix(sender.calls[2], "context+deadline+exceeded"))
+}
+
+// ctxSender is a fakeSender that fails if ctx is done.
+type ctxSender struct {
+	fakeSender
+}
+
+func (f *ctxSender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.fakeSender.Send(ctx, method, path, body)
+}
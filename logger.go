@@ -1,6 +1,19 @@
 package monibot
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
 // A Logger prints debug messages.
+//
+// If a Logger also has a method
+//
+//	Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+//
+// the Api logs each request, retry and failure through that method,
+// with structured attributes and appropriate levels. See NewSlogLogger.
 type Logger interface {
 
 	// Debug prints a debug message.
@@ -11,3 +24,32 @@ type Logger interface {
 type zeroLogger struct{}
 
 func (zeroLogger) Debug(format string, args ...any) {}
+
+func (zeroLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {}
+
+// NewSlogLogger creates a Logger that writes to a *slog.Logger.
+//
+// The Api logs requests and responses at level Debug, retries at
+// level Warn and final failures at level Error. Records carry
+// attributes like method, path, trial, status, duration_ms, bytes
+// and error.
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger}
+}
+
+// A SlogLogger is a Logger that writes to a *slog.Logger.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// Debug logs a formatted message at level Debug.
+func (l *SlogLogger) Debug(format string, args ...any) {
+	if l.logger.Enabled(context.Background(), slog.LevelDebug) {
+		l.logger.Debug(fmt.Sprintf(format, args...))
+	}
+}
+
+// Log logs a structured record.
+func (l *SlogLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,47 @@
+package monibot_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+	"github.com/cvilsmeier/monibot-go/monibottest"
+)
+
+func TestSlogLogger(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		Logger:     monibot.NewSlogLogger(slog.New(handler)),
+		MonibotUrl: srv.URL,
+		Trials:     2,
+		Delay:      time.Millisecond,
+	})
+	srv.FailNext(2, 503, 0)
+	err := api.GetPing()
+	is.True(err != nil)
+	var records []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record map[string]any
+		is.Nil(dec.Decode(&record))
+		records = append(records, record)
+	}
+	is.Eq(2, len(records))
+	is.Eq("WARN", records[0]["level"])
+	is.Eq("retrying", records[0]["msg"])
+	is.Eq("GET", records[0]["method"])
+	is.Eq("ping", records[0]["path"])
+	is.Eq(float64(1), records[0]["trial"])
+	is.Eq(float64(503), records[0]["status"])
+	is.Eq("ERROR", records[1]["level"])
+	is.Eq("request failed", records[1]["msg"])
+	is.Eq(float64(2), records[1]["trial"])
+}
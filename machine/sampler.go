@@ -0,0 +1,395 @@
+// Package machine samples machine resource usage from the Linux
+// proc filesystem and produces monibot.MachineSample values.
+//
+//	sampler := machine.NewSampler()
+//	sample, err := sampler.Sample()
+//	...
+//	api.PostMachineSample(machineId, sample)
+//
+// A Sampler keeps state between calls, so that CPU usage and
+// disk and network bytes are computed since the last sample.
+package machine
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+)
+
+// SamplerOptions holds optional parameters for a Sampler.
+type SamplerOptions struct {
+
+	// ProcRoot is the directory where the proc filesystem is mounted.
+	// Set it to a fixture directory for testing.
+	// Default is "/proc".
+	ProcRoot string
+}
+
+// A Sampler reads machine resource usage from the proc filesystem.
+// It is safe for concurrent use.
+type Sampler struct {
+	procRoot     string
+	statfs       statfsFunc
+	evalSymlinks func(path string) (string, error)
+	now          func() time.Time
+	mu           sync.Mutex
+	prev         *counters // counters of last sample, nil if there was none
+}
+
+// statfsFunc returns total and free bytes of the filesystem mounted at path.
+type statfsFunc func(path string) (total, free uint64, err error)
+
+// counters holds monotonic counters read from the proc filesystem.
+type counters struct {
+	cpuTotal uint64
+	cpuIdle  uint64
+	disks    map[string]ioCounter // keyed by device name, e.g. "sda1"
+	nets     map[string]ioCounter // keyed by interface name, e.g. "eth0"
+}
+
+type ioCounter struct {
+	read  uint64 // bytes read or received
+	write uint64 // bytes written or sent
+}
+
+// NewSampler creates a Sampler that reads from /proc.
+func NewSampler() *Sampler {
+	return NewSamplerWithOptions(SamplerOptions{})
+}
+
+// NewSamplerWithOptions creates a Sampler with custom options.
+func NewSamplerWithOptions(options SamplerOptions) *Sampler {
+	return &Sampler{
+		procRoot:     cmp.Or(options.ProcRoot, "/proc"),
+		statfs:       statfs,
+		evalSymlinks: filepath.EvalSymlinks,
+		now:          time.Now,
+	}
+}
+
+// Sample reads the current resource usage. CPU usage is computed
+// since the last sample, or since boot for the first sample.
+// Disk and network bytes are computed since the last sample, and
+// are 0 for the first sample and for disks and network interfaces
+// that were not present in the last sample.
+func (s *Sampler) Sample() (monibot.MachineSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sample := monibot.MachineSample{Tstamp: s.now().UnixMilli()}
+	// load
+	load1, load5, load15, err := s.readLoadavg()
+	if err != nil {
+		return sample, err
+	}
+	sample.Load1, sample.Load5, sample.Load15 = load1, load5, load15
+	// mem
+	sample.MemPercent, err = s.readMeminfo()
+	if err != nil {
+		return sample, err
+	}
+	// counters
+	curr := &counters{}
+	curr.cpuTotal, curr.cpuIdle, err = s.readStat()
+	if err != nil {
+		return sample, err
+	}
+	curr.disks, err = s.readDiskstats()
+	if err != nil {
+		return sample, err
+	}
+	curr.nets, err = s.readNetDev()
+	if err != nil {
+		return sample, err
+	}
+	prev := s.prev
+	if prev == nil {
+		prev = &counters{}
+	}
+	sample.CpuPercent = percent(delta(curr.cpuTotal, prev.cpuTotal)-delta(curr.cpuIdle, prev.cpuIdle), delta(curr.cpuTotal, prev.cpuTotal))
+	// disks
+	mounts, err := s.readMounts()
+	if err != nil {
+		return sample, err
+	}
+	var diskTotal, diskUsed uint64
+	for _, m := range mounts {
+		total, free, err := s.statfs(m.mountpoint)
+		if err != nil || total == 0 {
+			continue // not accessible, e.g. permission denied
+		}
+		used := total - min(free, total)
+		disk := monibot.DiskSample{
+			Device:      m.device,
+			Mountpoint:  m.mountpoint,
+			Total:       int64(total),
+			Used:        int64(used),
+			UsedPercent: percent(used, total),
+		}
+		disk.ReadBytes, disk.WriteBytes = ioDelta(curr.disks, prev.disks, s.diskName(m.device))
+		sample.Disks = append(sample.Disks, disk)
+		diskTotal += total
+		diskUsed += used
+		sample.DiskRead += disk.ReadBytes
+		sample.DiskWrite += disk.WriteBytes
+	}
+	sample.DiskPercent = percent(diskUsed, diskTotal)
+	// nets
+	for _, name := range slices.Sorted(maps.Keys(curr.nets)) {
+		net := monibot.NetSample{Device: name}
+		net.RecvBytes, net.SendBytes = ioDelta(curr.nets, prev.nets, name)
+		sample.Nets = append(sample.Nets, net)
+		sample.NetRecv += net.RecvBytes
+		sample.NetSend += net.SendBytes
+	}
+	s.prev = curr
+	return sample, nil
+}
+
+// readLoadavg reads /proc/loadavg, e.g. "0.52 0.58 0.59 1/467 12345".
+func (s *Sampler) readLoadavg() (float64, float64, float64, error) {
+	data, err := s.readFile("loadavg")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("cannot parse loadavg %q", data)
+	}
+	var loads [3]float64
+	for i := range loads {
+		loads[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("cannot parse loadavg %q: %w", data, err)
+		}
+	}
+	return loads[0], loads[1], loads[2], nil
+}
+
+// readMeminfo reads /proc/meminfo and returns the used memory percent.
+func (s *Sampler) readMeminfo() (int, error) {
+	data, err := s.readFile("meminfo")
+	if err != nil {
+		return 0, err
+	}
+	var total, avail uint64
+	for line := range lines(data) {
+		// "MemTotal:       16318480 kB"
+		key, value, _ := strings.Cut(line, ":")
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "MemTotal":
+			total, err = strconv.ParseUint(fields[0], 10, 64)
+		case "MemAvailable":
+			avail, err = strconv.ParseUint(fields[0], 10, 64)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse meminfo line %q: %w", line, err)
+		}
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("meminfo has no MemTotal")
+	}
+	return percent(total-min(avail, total), total), nil
+}
+
+// readStat reads /proc/stat and returns total and idle cpu ticks.
+func (s *Sampler) readStat() (uint64, uint64, error) {
+	data, err := s.readFile("stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	for line := range lines(data) {
+		// "cpu  user nice system idle iowait irq softirq steal guest guest_nice"
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var total, idle uint64
+		for i, field := range fields[1:min(len(fields), 9)] {
+			ticks, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("cannot parse stat line %q: %w", line, err)
+			}
+			total += ticks
+			if i == 3 || i == 4 {
+				idle += ticks // idle and iowait
+			}
+		}
+		return total, idle, nil
+	}
+	return 0, 0, fmt.Errorf("stat has no cpu line")
+}
+
+// readDiskstats reads /proc/diskstats and returns bytes read
+// and written per device.
+func (s *Sampler) readDiskstats() (map[string]ioCounter, error) {
+	data, err := s.readFile("diskstats")
+	if err != nil {
+		return nil, err
+	}
+	const sectorSize = 512 // diskstats always counts 512-byte sectors
+	disks := make(map[string]ioCounter)
+	for line := range lines(data) {
+		// "8 0 sda 1 2 sectorsRead 4 5 6 sectorsWritten ..."
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		read, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse diskstats line %q: %w", line, err)
+		}
+		written, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse diskstats line %q: %w", line, err)
+		}
+		disks[fields[2]] = ioCounter{read * sectorSize, written * sectorSize}
+	}
+	return disks, nil
+}
+
+// readNetDev reads /proc/net/dev and returns bytes received
+// and sent per interface, except the loopback interface.
+func (s *Sampler) readNetDev() (map[string]ioCounter, error) {
+	data, err := s.readFile("net/dev")
+	if err != nil {
+		return nil, err
+	}
+	nets := make(map[string]ioCounter)
+	for line := range lines(data) {
+		// "  eth0: recvBytes packets errs drop fifo frame compressed multicast sendBytes ..."
+		name, rest, found := strings.Cut(line, ":")
+		if !found {
+			continue // header line
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(rest)
+		if name == "lo" || len(fields) < 9 {
+			continue
+		}
+		recv, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse net/dev line %q: %w", line, err)
+		}
+		sent, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse net/dev line %q: %w", line, err)
+		}
+		nets[name] = ioCounter{recv, sent}
+	}
+	return nets, nil
+}
+
+type mount struct {
+	device     string
+	mountpoint string
+}
+
+// readMounts reads /proc/mounts and returns the mounted block
+// devices, each device only once.
+func (s *Sampler) readMounts() ([]mount, error) {
+	data, err := s.readFile("mounts")
+	if err != nil {
+		return nil, err
+	}
+	var mounts []mount
+	seen := make(map[string]bool)
+	for line := range lines(data) {
+		// "/dev/sda1 / ext4 rw,relatime 0 0"
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		device, mountpoint := fields[0], unescapeMountpoint(fields[1])
+		if !strings.HasPrefix(device, "/dev/") || strings.HasPrefix(device, "/dev/loop") || seen[device] {
+			continue
+		}
+		seen[device] = true
+		mounts = append(mounts, mount{device, mountpoint})
+	}
+	return mounts, nil
+}
+
+// diskName returns the diskstats name of a device, e.g. "sda1"
+// for "/dev/sda1" or "dm-0" for "/dev/mapper/vg-root".
+func (s *Sampler) diskName(device string) string {
+	if target, err := s.evalSymlinks(device); err == nil {
+		device = target
+	}
+	return filepath.Base(device)
+}
+
+func (s *Sampler) readFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.procRoot, name))
+}
+
+// unescapeMountpoint decodes octal escapes like "\040" (space) in /proc/mounts.
+func unescapeMountpoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func lines(data []byte) func(yield func(string) bool) {
+	return func(yield func(string) bool) {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			if !yield(sc.Text()) {
+				return
+			}
+		}
+	}
+}
+
+// ioDelta returns the bytes read and written by a device since the
+// last sample, or 0 if the device was not present in the last sample.
+func ioDelta(curr, prev map[string]ioCounter, name string) (int64, int64) {
+	p, ok := prev[name]
+	if !ok {
+		return 0, 0
+	}
+	c := curr[name]
+	return int64(delta(c.read, p.read)), int64(delta(c.write, p.write))
+}
+
+// delta returns curr-prev, or 0 if the counter was reset.
+func delta(curr, prev uint64) uint64 {
+	if curr < prev {
+		return 0
+	}
+	return curr - prev
+}
+
+// percent returns part/total as percent 0..100.
+func percent(part, total uint64) int {
+	if total == 0 {
+		return 0
+	}
+	return int(min(100, (part*100+total/2)/total))
+}
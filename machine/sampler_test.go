@@ -0,0 +1,82 @@
+package machine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestSampler(t *testing.T) {
+	str := func(s monibot.MachineSample) string {
+		text := fmt.Sprintf("tstamp=%d load=%.2f/%.2f/%.2f cpu=%d mem=%d disk=%d/%d/%d net=%d/%d",
+			s.Tstamp, s.Load1, s.Load5, s.Load15, s.CpuPercent, s.MemPercent,
+			s.DiskPercent, s.DiskRead, s.DiskWrite, s.NetRecv, s.NetSend)
+		for _, d := range s.Disks {
+			text += fmt.Sprintf(" [%s %s %d %d %d%% %d %d]", d.Device, d.Mountpoint, d.Total, d.Used, d.UsedPercent, d.ReadBytes, d.WriteBytes)
+		}
+		for _, n := range s.Nets {
+			text += fmt.Sprintf(" [%s %d %d]", n.Device, n.RecvBytes, n.SendBytes)
+		}
+		return text
+	}
+	is := assert.New(t)
+	sampler := NewSamplerWithOptions(SamplerOptions{ProcRoot: "testdata/proc1"})
+	sampler.now = func() time.Time {
+		return time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	}
+	sampler.statfs = func(path string) (uint64, uint64, error) {
+		switch path {
+		case "/":
+			return 1000, 250, nil
+		case "/mnt/HC Volume":
+			return 3000, 3000, nil
+		case "/data":
+			return 2000, 1000, nil
+		case "/backup":
+			return 1000, 1000, nil
+		}
+		return 0, 0, fmt.Errorf("no such mountpoint %q", path)
+	}
+	sampler.evalSymlinks = func(path string) (string, error) {
+		if path == "/dev/mapper/vg-data" {
+			return "/dev/dm-0", nil
+		}
+		return path, nil
+	}
+	// first sample has cpu since boot and no byte deltas
+	sample, err := sampler.Sample()
+	is.Nil(err)
+	is.Eq("tstamp=1704189600000 load=0.52/0.58/0.59 cpu=20 mem=25 disk=19/0/0 net=0/0"+
+		" [/dev/sda1 / 1000 750 75% 0 0]"+
+		" [/dev/sdb /mnt/HC Volume 3000 0 0% 0 0]"+
+		" [eth0 0 0]"+
+		" [eth1 0 0]", str(sample))
+	// second sample has deltas since first sample, and no deltas
+	// for the new disk sdc and the new interface eth2
+	sampler.procRoot = "testdata/proc2"
+	sample, err = sampler.Sample()
+	is.Nil(err)
+	is.Eq("tstamp=1704189600000 load=1.25/0.75/0.10 cpu=30 mem=75 disk=25/158720/317440 net=1000/600"+
+		" [/dev/sda1 / 1000 750 75% 51200 102400]"+
+		" [/dev/sdb /mnt/HC Volume 3000 0 0% 5120 10240]"+
+		" [/dev/mapper/vg-data /data 2000 1000 50% 102400 204800]"+
+		" [/dev/sdc /backup 1000 0 0% 0 0]"+
+		" [eth0 1000 500]"+
+		" [eth1 0 100]"+
+		" [eth2 0 0]", str(sample))
+	// missing files are reported
+	sampler.procRoot = "testdata/nonexisting"
+	_, err = sampler.Sample()
+	is.True(err != nil)
+}
+
+func TestUnescapeMountpoint(t *testing.T) {
+	is := assert.New(t)
+	is.Eq("/", unescapeMountpoint("/"))
+	is.Eq("/mnt/a b", unescapeMountpoint(`/mnt/a\040b`))
+	is.Eq("/mnt/a\tb", unescapeMountpoint(`/mnt/a\011b`))
+	is.Eq(`/mnt/a\`, unescapeMountpoint(`/mnt/a\`))
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package machine
+
+import "errors"
+
+func statfs(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("statfs is only supported on linux")
+}
@@ -0,0 +1,584 @@
+// Package monibottest provides an in-process fake Monibot server
+// for integration tests.
+//
+//	srv := monibottest.NewServer("test-api-key")
+//	defer srv.Close()
+//	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 3600_000})
+//	api := monibot.NewApiWithOptions("test-api-key", monibot.ApiOptions{MonibotUrl: srv.URL})
+//	api.PostWatchdogHeartbeat("w1")
+//	if srv.Heartbeats("w1") != 1 {
+//		t.Fatal("want 1 heartbeat")
+//	}
+//
+// The server keeps all state in memory, validates the api key and
+// can inject faults like status 429, status 5xx or latency.
+package monibottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/histogram"
+)
+
+// A Server is a fake Monibot server. It is safe for concurrent use.
+type Server struct {
+	URL string // The base url, use it as ApiOptions.MonibotUrl.
+
+	server     *httptest.Server
+	apiKey     string
+	mu         sync.Mutex
+	watchdogs  []monibot.Watchdog
+	machines   []monibot.Machine
+	metrics    []monibot.Metric
+	requests   int
+	heartbeats map[string]int
+	samples    map[string][]monibot.MachineSample
+	texts      map[string][]string
+	counters   map[string]int64
+	gauges     map[string]int64
+	histograms map[string][]int64
+	faults     []fault
+	latency    time.Duration
+	lastId     int // for generating ids of created resources
+}
+
+type fault struct {
+	status     int
+	retryAfter int
+}
+
+// NewServer starts a Server that accepts requests with apiKey.
+// The caller must call Close when finished.
+func NewServer(apiKey string) *Server {
+	s := &Server{
+		apiKey:     apiKey,
+		heartbeats: make(map[string]int),
+		samples:    make(map[string][]monibot.MachineSample),
+		texts:      make(map[string][]string),
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]int64),
+		histograms: make(map[string][]int64),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/ping", s.handle(s.getPing))
+	mux.HandleFunc("GET /api/watchdogs", s.handle(s.getWatchdogs))
+	mux.HandleFunc("GET /api/watchdog/{id}", s.handle(s.getWatchdog))
+	mux.HandleFunc("POST /api/watchdogs", s.handle(s.createWatchdog))
+	mux.HandleFunc("PUT /api/watchdog/{id}", s.handle(s.updateWatchdog))
+	mux.HandleFunc("DELETE /api/watchdog/{id}", s.handle(s.deleteWatchdog))
+	mux.HandleFunc("POST /api/watchdog/{id}/heartbeat", s.handle(s.postWatchdogHeartbeat))
+	mux.HandleFunc("GET /api/machines", s.handle(s.getMachines))
+	mux.HandleFunc("GET /api/machine/{id}", s.handle(s.getMachine))
+	mux.HandleFunc("POST /api/machines", s.handle(s.createMachine))
+	mux.HandleFunc("PUT /api/machine/{id}", s.handle(s.updateMachine))
+	mux.HandleFunc("DELETE /api/machine/{id}", s.handle(s.deleteMachine))
+	mux.HandleFunc("POST /api/machine/{id}/sample", s.handle(s.postMachineSample))
+	mux.HandleFunc("POST /api/machine/{id}/text", s.handle(s.postMachineText))
+	mux.HandleFunc("GET /api/metrics", s.handle(s.getMetrics))
+	mux.HandleFunc("GET /api/metric/{id}", s.handle(s.getMetric))
+	mux.HandleFunc("POST /api/metrics", s.handle(s.createMetric))
+	mux.HandleFunc("PUT /api/metric/{id}", s.handle(s.updateMetric))
+	mux.HandleFunc("DELETE /api/metric/{id}", s.handle(s.deleteMetric))
+	mux.HandleFunc("POST /api/metric/{id}/inc", s.handle(s.postMetricInc))
+	mux.HandleFunc("POST /api/metric/{id}/set", s.handle(s.postMetricSet))
+	mux.HandleFunc("POST /api/metric/{id}/values", s.handle(s.postMetricValues))
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddWatchdog adds a watchdog.
+func (s *Server) AddWatchdog(watchdog monibot.Watchdog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchdogs = append(s.watchdogs, watchdog)
+}
+
+// AddMachine adds a machine.
+func (s *Server) AddMachine(machine monibot.Machine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.machines = append(s.machines, machine)
+}
+
+// AddMetric adds a metric.
+func (s *Server) AddMetric(metric monibot.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, metric)
+}
+
+// FailNext makes the next count requests fail with status, e.g. 429 or 503.
+// If retryAfter is > 0, a Retry-After header with that many seconds is sent.
+func (s *Server) FailNext(count, status, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range count {
+		s.faults = append(s.faults, fault{status, retryAfter})
+	}
+}
+
+// SetLatency delays each response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Requests returns the number of requests received, including
+// requests that failed.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Heartbeats returns the number of heartbeats received for a watchdog.
+func (s *Server) Heartbeats(watchdogId string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.heartbeats[watchdogId]
+}
+
+// MachineSamples returns the samples received for a machine.
+func (s *Server) MachineSamples(machineId string) []monibot.MachineSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.samples[machineId])
+}
+
+// MachineTexts returns the texts received for a machine.
+func (s *Server) MachineTexts(machineId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.texts[machineId])
+}
+
+// CounterValue returns the sum of all increments received for a counter metric.
+func (s *Server) CounterValue(metricId string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[metricId]
+}
+
+// GaugeValue returns the last value received for a gauge metric.
+func (s *Server) GaugeValue(metricId string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gauges[metricId]
+}
+
+// HistogramValues returns all values received for a histogram
+// metric, sorted in ascending order.
+func (s *Server) HistogramValues(metricId string) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := slices.Clone(s.histograms[metricId])
+	slices.Sort(values)
+	return values
+}
+
+// A handlerFunc handles a request while s.mu is locked. It returns
+// the response status and the response value, which is encoded as JSON.
+type handlerFunc func(r *http.Request) (int, any)
+
+// handle wraps a handlerFunc with locking, fault injection,
+// latency and api key validation.
+func (s *Server) handle(f handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		latency := s.latency
+		var flt *fault
+		if len(s.faults) > 0 {
+			flt = &s.faults[0]
+			s.faults = s.faults[1:]
+		}
+		s.mu.Unlock()
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if flt != nil {
+			if flt.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(flt.retryAfter))
+			}
+			w.WriteHeader(flt.status)
+			fmt.Fprintf(w, "%d - %s (injected fault)", flt.status, http.StatusText(flt.status))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+			w.WriteHeader(401)
+			fmt.Fprintf(w, "401 - Unauthorized (invalid apiKey)")
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "400 - Bad Request (%s)", err)
+			return
+		}
+		s.mu.Lock()
+		status, value := f(r)
+		s.mu.Unlock()
+		if status != 200 {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, "%d - %s", status, value)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if value == nil {
+			value = map[string]bool{"ok": true}
+		}
+		json.NewEncoder(w).Encode(value)
+	}
+}
+
+func (s *Server) getPing(r *http.Request) (int, any) {
+	return 200, nil
+}
+
+func (s *Server) getWatchdogs(r *http.Request) (int, any) {
+	return 200, cloneOrEmpty(s.watchdogs)
+}
+
+func (s *Server) getWatchdog(r *http.Request) (int, any) {
+	i := s.findWatchdog(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	return 200, s.watchdogs[i]
+}
+
+func (s *Server) createWatchdog(r *http.Request) (int, any) {
+	name, intervalMillis, status, msg := parseWatchdog(r)
+	if status != 200 {
+		return status, msg
+	}
+	watchdog := monibot.Watchdog{Id: s.newId(), Name: name, IntervalMillis: intervalMillis}
+	s.watchdogs = append(s.watchdogs, watchdog)
+	return 200, watchdog
+}
+
+func (s *Server) updateWatchdog(r *http.Request) (int, any) {
+	i := s.findWatchdog(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	name, intervalMillis, status, msg := parseWatchdog(r)
+	if status != 200 {
+		return status, msg
+	}
+	s.watchdogs[i].Name = name
+	s.watchdogs[i].IntervalMillis = intervalMillis
+	return 200, s.watchdogs[i]
+}
+
+func (s *Server) deleteWatchdog(r *http.Request) (int, any) {
+	i := s.findWatchdog(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	s.watchdogs = slices.Delete(s.watchdogs, i, i+1)
+	return 200, nil
+}
+
+func (s *Server) postWatchdogHeartbeat(r *http.Request) (int, any) {
+	id := r.PathValue("id")
+	if s.findWatchdog(id) < 0 {
+		return 404, "Not Found"
+	}
+	s.heartbeats[id]++
+	return 200, nil
+}
+
+func (s *Server) getMachines(r *http.Request) (int, any) {
+	return 200, cloneOrEmpty(s.machines)
+}
+
+func (s *Server) getMachine(r *http.Request) (int, any) {
+	i := s.findMachine(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	return 200, s.machines[i]
+}
+
+func (s *Server) createMachine(r *http.Request) (int, any) {
+	name := r.PostForm.Get("name")
+	if name == "" {
+		return 400, "empty name"
+	}
+	machine := monibot.Machine{Id: s.newId(), Name: name}
+	s.machines = append(s.machines, machine)
+	return 200, machine
+}
+
+func (s *Server) updateMachine(r *http.Request) (int, any) {
+	i := s.findMachine(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	name := r.PostForm.Get("name")
+	if name == "" {
+		return 400, "empty name"
+	}
+	s.machines[i].Name = name
+	return 200, s.machines[i]
+}
+
+func (s *Server) deleteMachine(r *http.Request) (int, any) {
+	i := s.findMachine(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	s.machines = slices.Delete(s.machines, i, i+1)
+	return 200, nil
+}
+
+func (s *Server) postMachineSample(r *http.Request) (int, any) {
+	id := r.PathValue("id")
+	if s.findMachine(id) < 0 {
+		return 404, "Not Found"
+	}
+	sample, err := parseMachineSample(r.PostForm)
+	if err != nil {
+		return 400, err.Error()
+	}
+	s.samples[id] = append(s.samples[id], sample)
+	return 200, nil
+}
+
+func (s *Server) postMachineText(r *http.Request) (int, any) {
+	id := r.PathValue("id")
+	if s.findMachine(id) < 0 {
+		return 404, "Not Found"
+	}
+	s.texts[id] = append(s.texts[id], r.PostForm.Get("text"))
+	return 200, nil
+}
+
+func (s *Server) getMetrics(r *http.Request) (int, any) {
+	return 200, cloneOrEmpty(s.metrics)
+}
+
+func (s *Server) getMetric(r *http.Request) (int, any) {
+	i := s.findMetric(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	return 200, s.metrics[i]
+}
+
+func (s *Server) createMetric(r *http.Request) (int, any) {
+	name := r.PostForm.Get("name")
+	if name == "" {
+		return 400, "empty name"
+	}
+	metricType, err := strconv.Atoi(r.PostForm.Get("type"))
+	if err != nil || metricType < monibot.MetricTypeCounter || metricType > monibot.MetricTypeHistogram {
+		return 400, fmt.Sprintf("invalid type %q", r.PostForm.Get("type"))
+	}
+	metric := monibot.Metric{Id: s.newId(), Name: name, Type: metricType}
+	s.metrics = append(s.metrics, metric)
+	return 200, metric
+}
+
+func (s *Server) updateMetric(r *http.Request) (int, any) {
+	i := s.findMetric(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	name := r.PostForm.Get("name")
+	if name == "" {
+		return 400, "empty name"
+	}
+	s.metrics[i].Name = name
+	return 200, s.metrics[i]
+}
+
+func (s *Server) deleteMetric(r *http.Request) (int, any) {
+	i := s.findMetric(r.PathValue("id"))
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	s.metrics = slices.Delete(s.metrics, i, i+1)
+	return 200, nil
+}
+
+func (s *Server) postMetricInc(r *http.Request) (int, any) {
+	id, value, status, msg := s.metricValue(r, monibot.MetricTypeCounter)
+	if status != 200 {
+		return status, msg
+	}
+	s.counters[id] += value
+	return 200, nil
+}
+
+func (s *Server) postMetricSet(r *http.Request) (int, any) {
+	id, value, status, msg := s.metricValue(r, monibot.MetricTypeGauge)
+	if status != 200 {
+		return status, msg
+	}
+	s.gauges[id] = value
+	return 200, nil
+}
+
+func (s *Server) postMetricValues(r *http.Request) (int, any) {
+	id := r.PathValue("id")
+	if status, msg := s.checkMetric(id, monibot.MetricTypeHistogram); status != 200 {
+		return status, msg
+	}
+	values, err := histogram.ParseValues(r.PostForm.Get("values"))
+	if err != nil {
+		return 400, err.Error()
+	}
+	s.histograms[id] = append(s.histograms[id], values...)
+	return 200, nil
+}
+
+// metricValue validates a metric inc or set request.
+func (s *Server) metricValue(r *http.Request, metricType int) (string, int64, int, string) {
+	id := r.PathValue("id")
+	if status, msg := s.checkMetric(id, metricType); status != 200 {
+		return id, 0, status, msg
+	}
+	value, err := strconv.ParseInt(r.PostForm.Get("value"), 10, 64)
+	if err != nil || value < 0 {
+		return id, 0, 400, fmt.Sprintf("invalid value %q", r.PostForm.Get("value"))
+	}
+	return id, value, 200, ""
+}
+
+func (s *Server) checkMetric(id string, metricType int) (int, string) {
+	i := s.findMetric(id)
+	if i < 0 {
+		return 404, "Not Found"
+	}
+	if s.metrics[i].Type != metricType {
+		return 400, fmt.Sprintf("metric %s has type %d, not %d", id, s.metrics[i].Type, metricType)
+	}
+	return 200, ""
+}
+
+// newId returns a new 16-digit hex id, like the ids of monibot.io.
+func (s *Server) newId() string {
+	s.lastId++
+	return fmt.Sprintf("%016x", s.lastId)
+}
+
+func (s *Server) findWatchdog(id string) int {
+	return slices.IndexFunc(s.watchdogs, func(w monibot.Watchdog) bool { return w.Id == id })
+}
+
+func (s *Server) findMachine(id string) int {
+	return slices.IndexFunc(s.machines, func(m monibot.Machine) bool { return m.Id == id })
+}
+
+func (s *Server) findMetric(id string) int {
+	return slices.IndexFunc(s.metrics, func(m monibot.Metric) bool { return m.Id == id })
+}
+
+// cloneOrEmpty clones a slice so that it is encoded as [] and not as null.
+func cloneOrEmpty[T any](s []T) []T {
+	return append([]T{}, s...)
+}
+
+// parseWatchdog validates a create or update watchdog request.
+func parseWatchdog(r *http.Request) (string, int64, int, string) {
+	name := r.PostForm.Get("name")
+	if name == "" {
+		return "", 0, 400, "empty name"
+	}
+	intervalMillis, err := strconv.ParseInt(r.PostForm.Get("intervalMillis"), 10, 64)
+	if err != nil || intervalMillis <= 0 {
+		return "", 0, 400, fmt.Sprintf("invalid intervalMillis %q", r.PostForm.Get("intervalMillis"))
+	}
+	return name, intervalMillis, 200, ""
+}
+
+// parseMachineSample parses the form values sent by Api.PostMachineSample.
+func parseMachineSample(form url.Values) (monibot.MachineSample, error) {
+	var sample monibot.MachineSample
+	var err error
+	parseInt := func(key string) int64 {
+		if err != nil || !form.Has(key) {
+			return 0
+		}
+		var v int64
+		v, err = strconv.ParseInt(form.Get(key), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return v
+	}
+	parseFloat := func(key string) float64 {
+		if err != nil || !form.Has(key) {
+			return 0
+		}
+		var v float64
+		v, err = strconv.ParseFloat(form.Get(key), 64)
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return v
+	}
+	// parseCount parses the number of disks or nets, which cannot be
+	// larger than the number of form values
+	parseCount := func(key string) int64 {
+		n := parseInt(key)
+		if err == nil && (n < 0 || n > int64(len(form))) {
+			err = fmt.Errorf("invalid %s: %d", key, n)
+			return 0
+		}
+		return n
+	}
+	sample.Tstamp = parseInt("tstamp")
+	sample.Load1 = parseFloat("load1")
+	sample.Load5 = parseFloat("load5")
+	sample.Load15 = parseFloat("load15")
+	sample.CpuPercent = int(parseInt("cpu"))
+	sample.MemPercent = int(parseInt("mem"))
+	for i := range parseCount("disks") {
+		prefix := fmt.Sprintf("disks[%d].", i)
+		sample.Disks = append(sample.Disks, monibot.DiskSample{
+			Device:      form.Get(prefix + "device"),
+			Mountpoint:  form.Get(prefix + "mountpoint"),
+			Total:       parseInt(prefix + "total"),
+			Used:        parseInt(prefix + "used"),
+			UsedPercent: int(parseInt(prefix + "usedPercent")),
+			ReadBytes:   parseInt(prefix + "readBytes"),
+			WriteBytes:  parseInt(prefix + "writeBytes"),
+		})
+	}
+	sample.DiskPercent = int(parseInt("disk"))
+	sample.DiskRead = parseInt("diskRead")
+	sample.DiskWrite = parseInt("diskWrite")
+	for i := range parseCount("nets") {
+		prefix := fmt.Sprintf("nets[%d].", i)
+		sample.Nets = append(sample.Nets, monibot.NetSample{
+			Device:    form.Get(prefix + "device"),
+			RecvBytes: parseInt(prefix + "recvBytes"),
+			SendBytes: parseInt(prefix + "sendBytes"),
+		})
+	}
+	sample.NetRecv = parseInt("netRecv")
+	sample.NetSend = parseInt("netSend")
+	return sample, err
+}
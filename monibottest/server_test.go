@@ -0,0 +1,172 @@
+package monibottest
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+)
+
+func TestServer(t *testing.T) {
+	is := assert.New(t)
+	srv := NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 3600_000})
+	srv.AddMachine(monibot.Machine{Id: "m1", Name: "Server 1"})
+	srv.AddMetric(monibot.Metric{Id: "c1", Name: "Logins", Type: monibot.MetricTypeCounter})
+	srv.AddMetric(monibot.Metric{Id: "g1", Name: "Users", Type: monibot.MetricTypeGauge})
+	srv.AddMetric(monibot.Metric{Id: "h1", Name: "Latency", Type: monibot.MetricTypeHistogram})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl: srv.URL,
+		Trials:     3,
+		Delay:      time.Millisecond,
+	})
+	// ping
+	is.Nil(api.GetPing())
+	// watchdogs
+	watchdogs, err := api.GetWatchdogs()
+	is.Nil(err)
+	is.Eq(1, len(watchdogs))
+	is.Eq("Backup", watchdogs[0].Name)
+	watchdog, err := api.GetWatchdog("w1")
+	is.Nil(err)
+	is.Eq(int64(3600_000), watchdog.IntervalMillis)
+	is.Nil(api.PostWatchdogHeartbeat("w1"))
+	is.Nil(api.PostWatchdogHeartbeat("w1"))
+	is.Eq(2, srv.Heartbeats("w1"))
+	_, err = api.GetWatchdog("w2")
+	is.True(errors.Is(err, monibot.ErrNotFound))
+	// machines
+	machines, err := api.GetMachines()
+	is.Nil(err)
+	is.Eq(1, len(machines))
+	sample := monibot.MachineSample{
+		Tstamp:     1698400800000,
+		Load1:      1.5,
+		CpuPercent: 12,
+		Disks:      []monibot.DiskSample{{Device: "/dev/sda", Mountpoint: "/mnt/HC 1", Total: 100, Used: 10, UsedPercent: 10}},
+		Nets:       []monibot.NetSample{{Device: "eth0", RecvBytes: 13, SendBytes: 14}},
+		NetRecv:    13,
+		NetSend:    14,
+	}
+	is.Nil(api.PostMachineSample("m1", sample))
+	samples := srv.MachineSamples("m1")
+	is.Eq(1, len(samples))
+	is.Eq(fmt.Sprint(sample), fmt.Sprint(samples[0]))
+	_, err = parseMachineSample(url.Values{"tstamp": {"1"}, "disks": {"1000000000"}})
+	is.Eq("invalid disks: 1000000000", err.Error())
+	_, err = parseMachineSample(url.Values{"tstamp": {"1"}, "nets": {"-1"}})
+	is.Eq("invalid nets: -1", err.Error())
+	is.Nil(api.PostMachineText("m1", "hello\nworld"))
+	is.Eq("hello\nworld", srv.MachineTexts("m1")[0])
+	// metrics
+	metrics, err := api.GetMetrics()
+	is.Nil(err)
+	is.Eq(3, len(metrics))
+	is.Nil(api.PostMetricInc("c1", 2))
+	is.Nil(api.PostMetricInc("c1", 3))
+	is.Eq(int64(5), srv.CounterValue("c1"))
+	is.Nil(api.PostMetricSet("g1", 7))
+	is.Nil(api.PostMetricSet("g1", 4))
+	is.Eq(int64(4), srv.GaugeValue("g1"))
+	is.Nil(api.PostMetricValues("h1", []int64{3, 1}))
+	is.Nil(api.PostMetricValues("h1", []int64{2}))
+	is.Eq("[1 2 3]", fmt.Sprint(srv.HistogramValues("h1")))
+	err = api.PostMetricSet("c1", 1)
+	is.Eq("status 400: 400 - metric c1 has type 0, not 1", err.Error())
+	// invalid api key
+	wrongApi := monibot.NewApiWithOptions("wrong-key", monibot.ApiOptions{MonibotUrl: srv.URL})
+	err = wrongApi.GetPing()
+	is.True(errors.Is(err, monibot.ErrUnauthorized))
+}
+
+func TestServerFaults(t *testing.T) {
+	is := assert.New(t)
+	srv := NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 3600_000})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl: srv.URL,
+		Trials:     3,
+		Delay:      time.Millisecond,
+	})
+	// retries recover from faults
+	srv.FailNext(2, 503, 0)
+	is.Nil(api.PostWatchdogHeartbeat("w1"))
+	is.Eq(1, srv.Heartbeats("w1"))
+	is.Eq(3, srv.Requests())
+	// retries are exhausted
+	srv.FailNext(3, 429, 0)
+	err := api.PostWatchdogHeartbeat("w1")
+	is.True(errors.Is(err, monibot.ErrRateLimited))
+	is.True(errors.Is(err, monibot.ErrRetriesExhausted))
+	is.Eq(1, srv.Heartbeats("w1"))
+	is.Eq(6, srv.Requests())
+	// latency
+	srv.SetLatency(100 * time.Millisecond)
+	slowApi := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl: srv.URL,
+		Trials:     1,
+		Timeout:    10 * time.Millisecond,
+	})
+	err = slowApi.PostWatchdogHeartbeat("w1")
+	is.True(err != nil)
+	is.Eq(1, srv.Heartbeats("w1"))
+}
+
+func TestServerManagement(t *testing.T) {
+	is := assert.New(t)
+	srv := NewServer("api-key-123")
+	defer srv.Close()
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{MonibotUrl: srv.URL})
+	// watchdogs
+	watchdog, err := api.CreateWatchdog("Backup", time.Hour)
+	is.Nil(err)
+	is.Eq("0000000000000001", watchdog.Id)
+	is.Eq(int64(3600_000), watchdog.IntervalMillis)
+	watchdog, err = api.UpdateWatchdog(watchdog.Id, "Daily Backup", 24*time.Hour)
+	is.Nil(err)
+	is.Eq("Daily Backup", watchdog.Name)
+	watchdog, err = api.GetWatchdog(watchdog.Id)
+	is.Nil(err)
+	is.Eq(int64(86400_000), watchdog.IntervalMillis)
+	is.Nil(api.DeleteWatchdog(watchdog.Id))
+	_, err = api.GetWatchdog(watchdog.Id)
+	is.True(errors.Is(err, monibot.ErrNotFound))
+	is.True(errors.Is(api.DeleteWatchdog(watchdog.Id), monibot.ErrNotFound))
+	// machines
+	machine, err := api.CreateMachine("web1")
+	is.Nil(err)
+	is.Eq("0000000000000002", machine.Id)
+	machine, err = api.UpdateMachine(machine.Id, "web2")
+	is.Nil(err)
+	is.Eq("web2", machine.Name)
+	is.Nil(api.DeleteMachine(machine.Id))
+	machines, err := api.GetMachines()
+	is.Nil(err)
+	is.Eq(0, len(machines))
+	// metrics
+	metric, err := api.CreateMetric("Latency", monibot.MetricTypeHistogram)
+	is.Nil(err)
+	is.Eq(monibot.MetricTypeHistogram, metric.Type)
+	is.Nil(api.PostMetricValues(metric.Id, []int64{5}))
+	metric, err = api.UpdateMetric(metric.Id, "Request Latency")
+	is.Nil(err)
+	is.Eq("Request Latency", metric.Name)
+	is.Eq(monibot.MetricTypeHistogram, metric.Type)
+	is.Nil(api.DeleteMetric(metric.Id))
+	is.True(errors.Is(api.PostMetricValues(metric.Id, []int64{5}), monibot.ErrNotFound))
+	// creates are not retried
+	requests := srv.Requests()
+	srv.FailNext(1, 503, 0)
+	_, err = api.CreateMachine("web3")
+	is.Eq("status 503: 503 - Service Unavailable (injected fault)", err.Error())
+	is.Eq(requests+1, srv.Requests())
+	machines, err = api.GetMachines()
+	is.Nil(err)
+	is.Eq(0, len(machines))
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package monibot
+
+const raceEnabled = false
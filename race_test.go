@@ -0,0 +1,7 @@
+//go:build race
+
+package monibot
+
+// raceEnabled is true if the race detector is enabled, which makes
+// sync.Pool drop items at random.
+const raceEnabled = true
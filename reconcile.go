@@ -0,0 +1,305 @@
+package monibot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Spec is the desired state of watchdogs, machines and metrics.
+// Resources are matched by name, ids are ignored.
+type Spec struct {
+	Watchdogs []Watchdog
+	Machines  []Machine
+	Metrics   []Metric
+}
+
+// A ChangeAction is the action of a planned Change.
+type ChangeAction int
+
+const (
+	ChangeCreate       ChangeAction = iota // Create a resource.
+	ChangeUpdate                           // Update a resource.
+	ChangeDelete                           // Delete a resource.
+	ChangeTypeMismatch                     // A metric has the wrong type, it must be fixed by hand.
+)
+
+func (a ChangeAction) String() string {
+	switch a {
+	case ChangeCreate:
+		return "create"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	case ChangeTypeMismatch:
+		return "type mismatch"
+	}
+	return "unknown"
+}
+
+// A Change is a difference between the desired and the actual state.
+type Change struct {
+	Action ChangeAction
+	Kind   string // "watchdog", "machine" or "metric"
+	Id     string // The id of the actual resource, empty for ChangeCreate.
+	Name   string
+	Detail string // e.g. "interval 1h0m0s -> 24h0m0s"
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s %s %q", c.Action, c.Kind, c.Name)
+	if c.Id != "" {
+		s += " (" + c.Id + ")"
+	}
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
+}
+
+// A Plan is the list of changes that make the actual state
+// match the desired state.
+type Plan struct {
+	Changes []Change
+}
+
+// Empty returns true if the actual state matches the desired state.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String returns one line per change.
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for _, c := range p.Changes {
+		sb.WriteString(c.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ReconcileOptions holds optional parameters for ReconcileWithOptions.
+type ReconcileOptions struct {
+
+	// Default is no logging.
+	Logger Logger
+
+	// Apply executes the plan. If false, Reconcile is a dry-run
+	// that only computes the plan.
+	// Default is false.
+	Apply bool
+
+	// Prune deletes resources that are not in the spec, and resources
+	// whose name is not unique. Only kinds with a non-nil slice in the
+	// spec are pruned, use an empty slice to delete all resources of
+	// a kind.
+	// Default is false, i.e. nothing is deleted.
+	Prune bool
+}
+
+// Reconcile is like ReconcileWithOptions with default options,
+// i.e. it computes the plan but does not apply it.
+func Reconcile(ctx context.Context, api Client, desired Spec) (*Plan, error) {
+	return ReconcileWithOptions(ctx, api, desired, ReconcileOptions{})
+}
+
+// ReconcileWithOptions compares the desired state with the actual
+// watchdogs, machines and metrics, and returns a plan of changes:
+// resources that are missing are created, and resources that differ
+// are updated. If options.Prune is true, resources that are not
+// desired are deleted. Metrics with the wrong type are reported as
+// ChangeTypeMismatch, because the type of a metric cannot be changed.
+//
+// If options.Apply is true, the creates, updates and deletes are
+// executed in plan order. Applying stops at the first error, which
+// is returned together with the plan.
+func ReconcileWithOptions(ctx context.Context, api Client, desired Spec, options ReconcileOptions) (*Plan, error) {
+	logger := options.Logger
+	if logger == nil {
+		logger = zeroLogger{}
+	}
+	plan, err := reconcilePlan(ctx, api, desired, options.Prune)
+	if err != nil {
+		return nil, err
+	}
+	if !options.Apply {
+		return plan, nil
+	}
+	for _, c := range plan.Changes {
+		if c.Action == ChangeTypeMismatch {
+			continue
+		}
+		logger.Debug("reconcile: %s", c)
+		if err := applyChange(ctx, api, desired, c); err != nil {
+			return plan, fmt.Errorf("cannot %s: %w", c, err)
+		}
+	}
+	return plan, nil
+}
+
+func reconcilePlan(ctx context.Context, api Client, desired Spec, prune bool) (*Plan, error) {
+	watchdogs, err := api.GetWatchdogsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	machines, err := api.GetMachinesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := api.GetMetricsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	err = diffResources(plan, "watchdog", desired.Watchdogs, watchdogs, prune && desired.Watchdogs != nil,
+		func(w Watchdog) (string, string) { return w.Id, w.Name },
+		func(want, have Watchdog) (ChangeAction, string, bool) {
+			if want.IntervalMillis != have.IntervalMillis {
+				return ChangeUpdate, fmt.Sprintf("interval %s -> %s", millis(have.IntervalMillis), millis(want.IntervalMillis)), true
+			}
+			return 0, "", false
+		},
+		func(w Watchdog) string { return "interval " + millis(w.IntervalMillis).String() },
+		func(w Watchdog) error {
+			if w.IntervalMillis < 1 {
+				return fmt.Errorf("interval %s", millis(w.IntervalMillis))
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = diffResources(plan, "machine", desired.Machines, machines, prune && desired.Machines != nil,
+		func(m Machine) (string, string) { return m.Id, m.Name },
+		func(want, have Machine) (ChangeAction, string, bool) { return 0, "", false },
+		func(m Machine) string { return "" },
+		func(m Machine) error { return nil },
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = diffResources(plan, "metric", desired.Metrics, metrics, prune && desired.Metrics != nil,
+		func(m Metric) (string, string) { return m.Id, m.Name },
+		func(want, have Metric) (ChangeAction, string, bool) {
+			if want.Type != have.Type {
+				return ChangeTypeMismatch, fmt.Sprintf("type %s, want %s", metricTypeName(have.Type), metricTypeName(want.Type)), true
+			}
+			return 0, "", false
+		},
+		func(m Metric) string { return "type " + metricTypeName(m.Type) },
+		func(m Metric) error {
+			if m.Type < MetricTypeCounter || m.Type > MetricTypeHistogram {
+				return fmt.Errorf("type %d", m.Type)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// diffResources adds the changes for one kind of resource to plan.
+// It returns an error if a desired resource is not valid, so that
+// nothing is applied for an invalid spec. If prune is true, actual
+// resources that are not desired are deleted, and if several actual
+// resources have a desired name, the first one is kept and the others
+// are deleted.
+func diffResources[T any](plan *Plan, kind string, desired, actual []T, prune bool, idName func(T) (string, string), compare func(want, have T) (ChangeAction, string, bool), describe func(T) string, validate func(T) error) error {
+	wanted := make(map[string]T)
+	for _, want := range desired {
+		_, name := idName(want)
+		if name == "" {
+			return fmt.Errorf("desired %s has no name", kind)
+		}
+		if _, found := wanted[name]; found {
+			return fmt.Errorf("desired %s %q is not unique", kind, name)
+		}
+		if err := validate(want); err != nil {
+			return fmt.Errorf("desired %s %q has invalid %w", kind, name, err)
+		}
+		wanted[name] = want
+	}
+	have := make(map[string]T)
+	for _, a := range actual {
+		id, name := idName(a)
+		if _, ok := wanted[name]; !ok {
+			if !prune {
+				continue
+			}
+			plan.Changes = append(plan.Changes, Change{Action: ChangeDelete, Kind: kind, Id: id, Name: name})
+			continue
+		}
+		if _, found := have[name]; found {
+			if !prune {
+				continue
+			}
+			plan.Changes = append(plan.Changes, Change{Action: ChangeDelete, Kind: kind, Id: id, Name: name, Detail: "duplicate name"})
+			continue
+		}
+		have[name] = a
+	}
+	for _, want := range desired {
+		_, name := idName(want)
+		a, found := have[name]
+		if !found {
+			plan.Changes = append(plan.Changes, Change{Action: ChangeCreate, Kind: kind, Name: name, Detail: describe(want)})
+			continue
+		}
+		if action, detail, changed := compare(want, a); changed {
+			id, _ := idName(a)
+			plan.Changes = append(plan.Changes, Change{Action: action, Kind: kind, Id: id, Name: name, Detail: detail})
+		}
+	}
+	return nil
+}
+
+func applyChange(ctx context.Context, api Client, desired Spec, c Change) error {
+	var err error
+	switch c.Kind {
+	case "watchdog":
+		w := findByName(desired.Watchdogs, c.Name, func(w Watchdog) string { return w.Name })
+		switch c.Action {
+		case ChangeCreate:
+			_, err = api.CreateWatchdogWithContext(ctx, w.Name, millis(w.IntervalMillis))
+		case ChangeUpdate:
+			_, err = api.UpdateWatchdogWithContext(ctx, c.Id, w.Name, millis(w.IntervalMillis))
+		case ChangeDelete:
+			err = api.DeleteWatchdogWithContext(ctx, c.Id)
+		}
+	case "machine":
+		switch c.Action {
+		case ChangeCreate:
+			_, err = api.CreateMachineWithContext(ctx, c.Name)
+		case ChangeDelete:
+			err = api.DeleteMachineWithContext(ctx, c.Id)
+		}
+	case "metric":
+		m := findByName(desired.Metrics, c.Name, func(m Metric) string { return m.Name })
+		switch c.Action {
+		case ChangeCreate:
+			_, err = api.CreateMetricWithContext(ctx, m.Name, m.Type)
+		case ChangeDelete:
+			err = api.DeleteMetricWithContext(ctx, c.Id)
+		}
+	}
+	return err
+}
+
+func findByName[T any](items []T, name string, nameOf func(T) string) T {
+	for _, item := range items {
+		if nameOf(item) == name {
+			return item
+		}
+	}
+	var zero T
+	return zero
+}
+
+func millis(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
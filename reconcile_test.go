@@ -0,0 +1,121 @@
+package monibot_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+	"github.com/cvilsmeier/monibot-go/monibottest"
+)
+
+func TestReconcile(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 3600_000})
+	srv.AddWatchdog(monibot.Watchdog{Id: "w2", Name: "Cleanup", IntervalMillis: 3600_000})
+	srv.AddMachine(monibot.Machine{Id: "m1", Name: "web1"})
+	srv.AddMachine(monibot.Machine{Id: "m2", Name: "web1"})
+	srv.AddMetric(monibot.Metric{Id: "c1", Name: "Logins", Type: monibot.MetricTypeCounter})
+	srv.AddMetric(monibot.Metric{Id: "g1", Name: "Users", Type: monibot.MetricTypeCounter})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{MonibotUrl: srv.URL})
+	desired := monibot.Spec{
+		Watchdogs: []monibot.Watchdog{
+			{Name: "Backup", IntervalMillis: 86400_000},
+			{Name: "Report", IntervalMillis: 3600_000},
+		},
+		Machines: []monibot.Machine{{Name: "web1"}},
+		Metrics: []monibot.Metric{
+			{Name: "Logins", Type: monibot.MetricTypeCounter},
+			{Name: "Users", Type: monibot.MetricTypeGauge},
+			{Name: "Latency", Type: monibot.MetricTypeHistogram},
+		},
+	}
+	// dry-run
+	plan, err := monibot.ReconcileWithOptions(context.Background(), api, desired, monibot.ReconcileOptions{Prune: true})
+	is.Nil(err)
+	is.True(!plan.Empty())
+	want := `delete watchdog "Cleanup" (w2)
+update watchdog "Backup" (w1): interval 1h0m0s -> 24h0m0s
+create watchdog "Report": interval 1h0m0s
+delete machine "web1" (m2): duplicate name
+type mismatch metric "Users" (g1): type counter, want gauge
+create metric "Latency": type histogram
+`
+	is.Eq(want, plan.String())
+	is.Eq(3, srv.Requests())
+	watchdogs, err := api.GetWatchdogs()
+	is.Nil(err)
+	is.Eq(2, len(watchdogs))
+	// apply
+	plan, err = monibot.ReconcileWithOptions(context.Background(), api, desired, monibot.ReconcileOptions{Apply: true, Prune: true})
+	is.Nil(err)
+	is.Eq(want, plan.String())
+	watchdogs, err = api.GetWatchdogs()
+	is.Nil(err)
+	is.Eq(2, len(watchdogs))
+	is.Eq("Backup", watchdogs[0].Name)
+	is.Eq(int64(86400_000), watchdogs[0].IntervalMillis)
+	is.Eq("Report", watchdogs[1].Name)
+	machines, err := api.GetMachines()
+	is.Nil(err)
+	is.Eq(1, len(machines))
+	is.Eq("m1", machines[0].Id)
+	metrics, err := api.GetMetrics()
+	is.Nil(err)
+	is.Eq(3, len(metrics))
+	is.Eq("Latency", metrics[2].Name)
+	// only the type mismatch is left
+	plan, err = monibot.Reconcile(context.Background(), api, desired)
+	is.Nil(err)
+	is.Eq(1, len(plan.Changes))
+	is.Eq(monibot.ChangeTypeMismatch, plan.Changes[0].Action)
+	// invalid spec
+	desired.Machines = append(desired.Machines, monibot.Machine{Name: "web1"})
+	_, err = monibot.Reconcile(context.Background(), api, desired)
+	is.Eq(`desired machine "web1" is not unique`, err.Error())
+	// invalid intervals and types are rejected before anything is applied
+	requests := srv.Requests()
+	_, err = monibot.ReconcileWithOptions(context.Background(), api, monibot.Spec{
+		Watchdogs: []monibot.Watchdog{{Name: "Hourly", IntervalMillis: 3600_000}},
+		Metrics:   []monibot.Metric{{Name: "Errors", Type: 7}},
+	}, monibot.ReconcileOptions{Apply: true, Prune: true})
+	is.Eq(`desired metric "Errors" has invalid type 7`, err.Error())
+	_, err = monibot.ReconcileWithOptions(context.Background(), api, monibot.Spec{
+		Watchdogs: []monibot.Watchdog{{Name: "Never"}},
+	}, monibot.ReconcileOptions{Apply: true, Prune: true})
+	is.Eq(`desired watchdog "Never" has invalid interval 0s`, err.Error())
+	is.Eq(requests+6, srv.Requests())
+}
+
+func TestReconcilePartialSpec(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 3600_000})
+	srv.AddWatchdog(monibot.Watchdog{Id: "w2", Name: "Cleanup", IntervalMillis: 3600_000})
+	srv.AddMachine(monibot.Machine{Id: "m1", Name: "web1"})
+	srv.AddMetric(monibot.Metric{Id: "c1", Name: "Logins", Type: monibot.MetricTypeCounter})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{MonibotUrl: srv.URL})
+	desired := monibot.Spec{
+		Watchdogs: []monibot.Watchdog{{Name: "Backup", IntervalMillis: 3600_000}},
+	}
+	// without prune, nothing is deleted
+	plan, err := monibot.ReconcileWithOptions(context.Background(), api, desired, monibot.ReconcileOptions{Apply: true})
+	is.Nil(err)
+	is.True(plan.Empty())
+	// with prune, only kinds in the spec are pruned
+	plan, err = monibot.ReconcileWithOptions(context.Background(), api, desired, monibot.ReconcileOptions{Apply: true, Prune: true})
+	is.Nil(err)
+	is.Eq("delete watchdog \"Cleanup\" (w2)\n", plan.String())
+	watchdogs, err := api.GetWatchdogs()
+	is.Nil(err)
+	is.Eq(1, len(watchdogs))
+	machines, err := api.GetMachines()
+	is.Nil(err)
+	is.Eq(1, len(machines))
+	metrics, err := api.GetMetrics()
+	is.Nil(err)
+	is.Eq(1, len(metrics))
+}
@@ -0,0 +1,207 @@
+package monibot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNameNotFound is returned by a Registry if no resource has a given name.
+	ErrNameNotFound = errors.New("name not found")
+
+	// ErrNameAmbiguous is returned by a Registry if more than one resource has a given name.
+	ErrNameAmbiguous = errors.New("name ambiguous")
+)
+
+// RegistryOptions holds optional parameters for a Registry.
+type RegistryOptions struct {
+
+	// The time watchdogs, machines and metrics are cached.
+	// Default is 5m.
+	TTL time.Duration
+}
+
+// A Registry resolves watchdogs, machines and metrics by name.
+// It loads them with GetWatchdogs, GetMachines and GetMetrics and
+// caches them for a TTL. Names are matched exactly.
+//
+// A Registry is safe for concurrent use.
+type Registry struct {
+	api       Client
+	ttl       time.Duration
+	now       func() time.Time
+	watchdogs registryCache[Watchdog]
+	machines  registryCache[Machine]
+	metrics   registryCache[Metric]
+}
+
+// registryCache holds the resources of one kind.
+type registryCache[T any] struct {
+	mu       sync.Mutex
+	items    []T
+	loadedAt time.Time // zero if not loaded
+}
+
+// NewRegistry creates a Registry that loads resources through api.
+func NewRegistry(api Client, options RegistryOptions) *Registry {
+	return &Registry{
+		api: api,
+		ttl: cmp.Or(options.TTL, 5*time.Minute),
+		now: time.Now,
+	}
+}
+
+// Invalidate clears the cache, so that the next lookup loads
+// all resources again.
+func (r *Registry) Invalidate() {
+	for _, c := range []interface{ invalidate() }{&r.watchdogs, &r.machines, &r.metrics} {
+		c.invalidate()
+	}
+}
+
+func (c *registryCache[T]) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = nil
+	c.loadedAt = time.Time{}
+}
+
+// Watchdog returns the watchdog with a name.
+func (r *Registry) Watchdog(ctx context.Context, name string) (Watchdog, error) {
+	return lookupName(ctx, r, &r.watchdogs, "watchdog", name, r.api.GetWatchdogsWithContext, func(w Watchdog) (string, string) { return w.Id, w.Name })
+}
+
+// Machine returns the machine with a name.
+func (r *Registry) Machine(ctx context.Context, name string) (Machine, error) {
+	return lookupName(ctx, r, &r.machines, "machine", name, r.api.GetMachinesWithContext, func(m Machine) (string, string) { return m.Id, m.Name })
+}
+
+// Metric returns the metric with a name.
+func (r *Registry) Metric(ctx context.Context, name string) (Metric, error) {
+	return lookupName(ctx, r, &r.metrics, "metric", name, r.api.GetMetricsWithContext, func(m Metric) (string, string) { return m.Id, m.Name })
+}
+
+// lookupName finds the item with a name, loading all items if the cache has expired.
+func lookupName[T any](ctx context.Context, r *Registry, c *registryCache[T], kind, name string, load func(context.Context) ([]T, error), idName func(T) (string, string)) (T, error) {
+	var zero T
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loadedAt.IsZero() || r.now().Sub(c.loadedAt) >= r.ttl {
+		items, err := load(ctx)
+		if err != nil {
+			return zero, fmt.Errorf("cannot load %ss: %w", kind, err)
+		}
+		c.items = items
+		c.loadedAt = r.now()
+	}
+	var found []T
+	var ids []string
+	for _, item := range c.items {
+		if id, n := idName(item); n == name {
+			found = append(found, item)
+			ids = append(ids, id)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return zero, fmt.Errorf("%w: no %s named %q", ErrNameNotFound, kind, name)
+	case 1:
+		return found[0], nil
+	}
+	return zero, fmt.Errorf("%w: %d %ss named %q: %s", ErrNameAmbiguous, len(found), kind, name, strings.Join(ids, ", "))
+}
+
+// PostWatchdogHeartbeatByName is like PostWatchdogHeartbeatByNameWithContext using context.Background.
+func (r *Registry) PostWatchdogHeartbeatByName(name string) error {
+	return r.PostWatchdogHeartbeatByNameWithContext(context.Background(), name)
+}
+
+// PostWatchdogHeartbeatByNameWithContext is like PostWatchdogHeartbeatWithContext
+// for the watchdog with a name.
+func (r *Registry) PostWatchdogHeartbeatByNameWithContext(ctx context.Context, name string) error {
+	watchdog, err := r.Watchdog(ctx, name)
+	if err != nil {
+		return err
+	}
+	return r.api.PostWatchdogHeartbeatWithContext(ctx, watchdog.Id)
+}
+
+// PostMachineSampleByName is like PostMachineSampleByNameWithContext using context.Background.
+func (r *Registry) PostMachineSampleByName(name string, sample MachineSample) error {
+	return r.PostMachineSampleByNameWithContext(context.Background(), name, sample)
+}
+
+// PostMachineSampleByNameWithContext is like PostMachineSampleWithContext
+// for the machine with a name.
+func (r *Registry) PostMachineSampleByNameWithContext(ctx context.Context, name string, sample MachineSample) error {
+	machine, err := r.Machine(ctx, name)
+	if err != nil {
+		return err
+	}
+	return r.api.PostMachineSampleWithContext(ctx, machine.Id, sample)
+}
+
+// PostMachineTextByName is like PostMachineTextByNameWithContext using context.Background.
+func (r *Registry) PostMachineTextByName(name string, text string) error {
+	return r.PostMachineTextByNameWithContext(context.Background(), name, text)
+}
+
+// PostMachineTextByNameWithContext is like PostMachineTextWithContext
+// for the machine with a name.
+func (r *Registry) PostMachineTextByNameWithContext(ctx context.Context, name string, text string) error {
+	machine, err := r.Machine(ctx, name)
+	if err != nil {
+		return err
+	}
+	return r.api.PostMachineTextWithContext(ctx, machine.Id, text)
+}
+
+// PostMetricIncByName is like PostMetricIncByNameWithContext using context.Background.
+func (r *Registry) PostMetricIncByName(name string, value int64) error {
+	return r.PostMetricIncByNameWithContext(context.Background(), name, value)
+}
+
+// PostMetricIncByNameWithContext is like PostMetricIncWithContext
+// for the metric with a name.
+func (r *Registry) PostMetricIncByNameWithContext(ctx context.Context, name string, value int64) error {
+	metric, err := r.Metric(ctx, name)
+	if err != nil {
+		return err
+	}
+	return r.api.PostMetricIncWithContext(ctx, metric.Id, value)
+}
+
+// PostMetricSetByName is like PostMetricSetByNameWithContext using context.Background.
+func (r *Registry) PostMetricSetByName(name string, value int64) error {
+	return r.PostMetricSetByNameWithContext(context.Background(), name, value)
+}
+
+// PostMetricSetByNameWithContext is like PostMetricSetWithContext
+// for the metric with a name.
+func (r *Registry) PostMetricSetByNameWithContext(ctx context.Context, name string, value int64) error {
+	metric, err := r.Metric(ctx, name)
+	if err != nil {
+		return err
+	}
+	return r.api.PostMetricSetWithContext(ctx, metric.Id, value)
+}
+
+// PostMetricValuesByName is like PostMetricValuesByNameWithContext using context.Background.
+func (r *Registry) PostMetricValuesByName(name string, values []int64) error {
+	return r.PostMetricValuesByNameWithContext(context.Background(), name, values)
+}
+
+// PostMetricValuesByNameWithContext is like PostMetricValuesWithContext
+// for the metric with a name.
+func (r *Registry) PostMetricValuesByNameWithContext(ctx context.Context, name string, values []int64) error {
+	metric, err := r.Metric(ctx, name)
+	if err != nil {
+		return err
+	}
+	return r.api.PostMetricValuesWithContext(ctx, metric.Id, values)
+}
@@ -0,0 +1,56 @@
+package monibot_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+	"github.com/cvilsmeier/monibot-go/monibottest"
+)
+
+func TestRegistry(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 60_000})
+	srv.AddMachine(monibot.Machine{Id: "m1", Name: "web1"})
+	srv.AddMetric(monibot.Metric{Id: "c1", Name: "Logins", Type: monibot.MetricTypeCounter})
+	srv.AddMetric(monibot.Metric{Id: "g1", Name: "Users", Type: monibot.MetricTypeGauge})
+	srv.AddMetric(monibot.Metric{Id: "g2", Name: "Users", Type: monibot.MetricTypeGauge})
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{MonibotUrl: srv.URL})
+	registry := monibot.NewRegistry(api, monibot.RegistryOptions{TTL: 50 * time.Millisecond})
+	// post by name
+	is.Nil(registry.PostWatchdogHeartbeatByName("Backup"))
+	is.Nil(registry.PostMachineTextByName("web1", "hello"))
+	is.Nil(registry.PostMetricIncByName("Logins", 2))
+	is.Nil(registry.PostMetricIncByName("Logins", 3))
+	is.Eq(1, srv.Heartbeats("w1"))
+	is.Eq(1, len(srv.MachineTexts("m1")))
+	is.Eq(int64(5), srv.CounterValue("c1"))
+	// 3 loads, 4 posts
+	is.Eq(7, srv.Requests())
+	// missing and ambiguous names
+	err := registry.PostMetricSetByName("Sessions", 1)
+	is.True(errors.Is(err, monibot.ErrNameNotFound))
+	is.Eq(`name not found: no metric named "Sessions"`, err.Error())
+	_, err = registry.Metric(context.Background(), "Users")
+	is.True(errors.Is(err, monibot.ErrNameAmbiguous))
+	is.Eq(`name ambiguous: 2 metrics named "Users": g1, g2`, err.Error())
+	is.Eq(7, srv.Requests())
+	// cache expires
+	srv.AddMetric(monibot.Metric{Id: "h1", Name: "Latency", Type: monibot.MetricTypeHistogram})
+	_, err = registry.Metric(context.Background(), "Latency")
+	is.True(errors.Is(err, monibot.ErrNameNotFound))
+	time.Sleep(60 * time.Millisecond)
+	is.Nil(registry.PostMetricValuesByName("Latency", []int64{1, 2}))
+	is.Eq(2, len(srv.HistogramValues("h1")))
+	// invalidate
+	srv.AddMachine(monibot.Machine{Id: "m2", Name: "web2"})
+	registry.Invalidate()
+	machine, err := registry.Machine(context.Background(), "web2")
+	is.Nil(err)
+	is.Eq("m2", machine.Id)
+}
@@ -0,0 +1,31 @@
+package monibot
+
+import (
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/sending"
+)
+
+// A RetryPolicy computes the time to wait between trials.
+// Delay(trial, prev) returns the time to wait after trial (1-based)
+// has failed, prev is the delay returned for the previous trial.
+type RetryPolicy = sending.RetryPolicy
+
+// ConstantRetryPolicy waits the same delay before each trial.
+func ConstantRetryPolicy(delay time.Duration) RetryPolicy {
+	return sending.ConstantRetry(delay)
+}
+
+// ExponentialRetryPolicy doubles the delay after each trial,
+// starting with base and never exceeding maxDelay.
+func ExponentialRetryPolicy(base, maxDelay time.Duration) RetryPolicy {
+	return sending.ExponentialRetry(base, maxDelay)
+}
+
+// DecorrelatedJitterRetryPolicy waits a random delay between base
+// and three times the previous delay, never exceeding maxDelay.
+// Use it if many hosts share the same API, so that they do not
+// retry in lockstep after an outage.
+func DecorrelatedJitterRetryPolicy(base, maxDelay time.Duration) RetryPolicy {
+	return sending.DecorrelatedJitterRetry(base, maxDelay)
+}
@@ -0,0 +1,243 @@
+package monibot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go/internal/spool"
+)
+
+// SpoolOptions holds optional parameters for a Spool.
+type SpoolOptions struct {
+
+	// The maximum size of all spool files. If the spool grows larger,
+	// the oldest posts are discarded.
+	// Default is 64 MB.
+	MaxBytes int64
+
+	// The maximum age of a spooled post. Older posts are discarded.
+	// Default is 24h.
+	MaxAge time.Duration
+
+	// The size of a single spool file (segment).
+	// Default is 1 MB.
+	SegmentBytes int64
+
+	// The interval in which spooled posts are replayed in the
+	// background.
+	// Default is 30s.
+	ReplayInterval time.Duration
+}
+
+// A Spool is a persistent, disk-backed queue for posts that could
+// not be sent. Use it with ApiOptions.Spool.
+//
+// Machine samples, machine texts and metric values that fail with
+// a network error, status 429 or status 5xx, after all trials, are
+// written to the spool. While the spool is not empty, new posts are
+// appended to it without being sent, so that posts are never sent
+// out of order. Watchdog heartbeats are never spooled, because a
+// late heartbeat would hide an outage.
+//
+// Spooled posts are replayed in order by a background goroutine
+// every ReplayInterval, and by Replay. Each spooled post is sent
+// with a single trial; replaying stops at the first post that
+// fails and is tried again in the next interval.
+//
+// A Spool is stored in a directory of append-only segment files with
+// checksums, which are synced to disk. It survives crashes and
+// restarts: a partially written post is discarded when the spool is
+// opened again. A Spool must not be used by more than one Api.
+type Spool struct {
+	mu             sync.Mutex // guards queue, pending, sender and logger
+	queue          *spool.Queue
+	pending        bool // true if queue is not empty
+	replayInterval time.Duration
+	replayMu       sync.Mutex // serializes replays
+	startOnce      sync.Once
+	sender         apiSender // single-trial sender for replays, set by start
+	logger         Logger
+	ctx            context.Context // cancelled on Close
+	cancel         context.CancelFunc
+	done           chan struct{} // closed when the replay goroutine ends
+}
+
+// OpenSpool opens or creates a Spool in directory dir.
+// The caller must call Close when finished.
+func OpenSpool(dir string, options SpoolOptions) (*Spool, error) {
+	maxBytes := cmp.Or(options.MaxBytes, 64<<20)
+	maxAge := cmp.Or(options.MaxAge, 24*time.Hour)
+	segmentBytes := cmp.Or(options.SegmentBytes, 1<<20)
+	queue, err := spool.Open(dir, maxBytes, maxAge, segmentBytes)
+	if err != nil {
+		return nil, err
+	}
+	_, pending, err := queue.Peek()
+	if err != nil {
+		queue.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Spool{
+		queue:          queue,
+		pending:        pending,
+		replayInterval: cmp.Or(options.ReplayInterval, 30*time.Second),
+		ctx:            ctx,
+		cancel:         cancel,
+	}, nil
+}
+
+// Close stops replaying and closes the spool. Spooled posts are
+// kept on disk.
+func (s *Spool) Close() error {
+	s.startOnce.Do(func() {}) // do not start after Close
+	s.cancel()
+	if s.done != nil {
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.Close()
+}
+
+// Dropped returns the number of spooled posts that were discarded
+// because the spool grew too large or the posts grew too old.
+func (s *Spool) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.Dropped()
+}
+
+// Replay sends spooled posts in order, until the spool is empty or
+// a post fails with a network error, status 429 or status 5xx.
+// Posts that fail with other errors are discarded. It returns the
+// error of the failed post, or nil if the spool is empty.
+func (s *Spool) Replay(ctx context.Context) error {
+	s.mu.Lock()
+	sender, logger := s.sender, s.logger
+	s.mu.Unlock()
+	if sender == nil {
+		return fmt.Errorf("spool is not used by an Api")
+	}
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	for {
+		s.mu.Lock()
+		rec, ok, err := s.queue.Peek()
+		if err == nil && !ok {
+			s.pending = false
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("cannot read spool: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		_, err = sender.Send(ctx, rec.Method, rec.Path, rec.Body)
+		if err != nil && isSpoolableError(err) {
+			logger.Debug("cannot replay %s %s: %s", rec.Method, rec.Path, err)
+			return err
+		}
+		if err != nil {
+			logger.Debug("discarding spooled %s %s: %s", rec.Method, rec.Path, err)
+		}
+		s.mu.Lock()
+		err = s.queue.Ack()
+		s.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("cannot ack spool: %w", err)
+		}
+	}
+}
+
+// start starts the replay goroutine, unless it is running or the
+// spool is closed.
+func (s *Spool) start(sender apiSender, logger Logger) {
+	s.startOnce.Do(func() {
+		s.mu.Lock()
+		s.sender = sender
+		s.logger = logger
+		s.mu.Unlock()
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *Spool) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			pending := s.pending
+			s.mu.Unlock()
+			if pending {
+				s.Replay(s.ctx)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// append writes a post to the spool.
+func (s *Spool) append(method, path string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.queue.Append(spool.Record{Time: time.Now(), Method: method, Path: path, Body: body}); err != nil {
+		return err
+	}
+	s.pending = true
+	return nil
+}
+
+// A spoolSender sends through the next sender and writes
+// failed posts to a spool.
+type spoolSender struct {
+	next   apiSender
+	spool  *Spool
+	logger Logger
+}
+
+func (s *spoolSender) Send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	if !isSpoolable(method, path) {
+		return s.next.Send(ctx, method, path, body)
+	}
+	s.spool.mu.Lock()
+	pending := s.spool.pending
+	s.spool.mu.Unlock()
+	if !pending {
+		data, err := s.next.Send(ctx, method, path, body)
+		if err == nil || !isSpoolableError(err) {
+			return data, err
+		}
+		s.logger.Debug("spooling %s %s: %s", method, path, err)
+	}
+	if err := s.spool.append(method, path, body); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// isSpoolable returns true for machine and metric posts.
+func isSpoolable(method, path string) bool {
+	return method == "POST" && (strings.HasPrefix(path, "machine/") || strings.HasPrefix(path, "metric/"))
+}
+
+// isSpoolableError returns true if a post failed for a reason
+// that will probably go away, e.g. a network error.
+func isSpoolableError(err error) bool {
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Status == 0 || apiErr.Status == 429 || apiErr.Status >= 500
+}
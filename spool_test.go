@@ -0,0 +1,92 @@
+package monibot_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cvilsmeier/monibot-go"
+	"github.com/cvilsmeier/monibot-go/internal/assert"
+	"github.com/cvilsmeier/monibot-go/monibottest"
+)
+
+func TestSpool(t *testing.T) {
+	is := assert.New(t)
+	dir := t.TempDir()
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddWatchdog(monibot.Watchdog{Id: "w1", Name: "Backup", IntervalMillis: 60_000})
+	srv.AddMetric(monibot.Metric{Id: "c1", Name: "Logins", Type: monibot.MetricTypeCounter})
+	newApi := func(spool *monibot.Spool) *monibot.Api {
+		return monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+			MonibotUrl: srv.URL,
+			Trials:     3,
+			Delay:      time.Millisecond,
+			Spool:      spool,
+		})
+	}
+	// no background replays during this test
+	options := monibot.SpoolOptions{ReplayInterval: time.Hour}
+	spool, err := monibot.OpenSpool(dir, options)
+	is.Nil(err)
+	is.True(spool.Replay(context.Background()) != nil) // not used by an Api
+	api := newApi(spool)
+	// outage: post is spooled after all trials, heartbeat is not spooled
+	srv.FailNext(7, 503, 0)
+	is.Nil(api.PostMetricInc("c1", 1))
+	is.True(api.PostWatchdogHeartbeat("w1") != nil)
+	is.Eq(int64(0), srv.CounterValue("c1"))
+	is.Eq(6, srv.Requests())
+	// while posts are spooled, new posts are spooled without sending
+	is.Nil(api.PostMetricInc("c1", 2))
+	is.Eq(6, srv.Requests())
+	// still down: replay sends one trial and stops
+	is.True(spool.Replay(context.Background()) != nil)
+	is.Eq(7, srv.Requests())
+	is.Eq(int64(0), srv.CounterValue("c1"))
+	// restart while posts are spooled
+	is.Nil(spool.Close())
+	spool, err = monibot.OpenSpool(dir, options)
+	is.Nil(err)
+	defer spool.Close()
+	api = newApi(spool)
+	is.Nil(api.PostMetricInc("c1", 4))
+	is.Eq(7, srv.Requests())
+	// back up: spooled posts are replayed in order
+	is.Nil(spool.Replay(context.Background()))
+	is.Eq(int64(7), srv.CounterValue("c1"))
+	is.Eq(10, srv.Requests())
+	is.Eq(0, spool.Dropped())
+	// spool is empty, posts are sent directly
+	is.Nil(api.PostMetricInc("c1", 8))
+	is.Eq(int64(15), srv.CounterValue("c1"))
+	is.Eq(11, srv.Requests())
+	// definitive errors are not spooled
+	is.True(api.PostMetricInc("c2", 1) != nil)
+	is.Nil(api.PostMetricInc("c1", 16))
+	is.Eq(int64(31), srv.CounterValue("c1"))
+	is.Eq(13, srv.Requests())
+}
+
+func TestSpoolBackgroundReplay(t *testing.T) {
+	is := assert.New(t)
+	srv := monibottest.NewServer("api-key-123")
+	defer srv.Close()
+	srv.AddMetric(monibot.Metric{Id: "c1", Name: "Logins", Type: monibot.MetricTypeCounter})
+	spool, err := monibot.OpenSpool(t.TempDir(), monibot.SpoolOptions{ReplayInterval: 5 * time.Millisecond})
+	is.Nil(err)
+	defer spool.Close()
+	api := monibot.NewApiWithOptions("api-key-123", monibot.ApiOptions{
+		MonibotUrl: srv.URL,
+		Trials:     1,
+		Spool:      spool,
+	})
+	srv.FailNext(1, 503, 0)
+	is.Nil(api.PostMetricInc("c1", 1))
+	// the spool drains without further posts
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.CounterValue("c1") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	is.Eq(int64(1), srv.CounterValue("c1"))
+}
@@ -1,4 +1,4 @@
 package monibot
 
 // Version is monibot-go sdk version.
-const Version = "0.3.0"
+const Version = "0.4.0"